@@ -0,0 +1,140 @@
+package libtorrent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/tracker"
+)
+
+// last forced announce results per tracker url
+type announceInfo struct {
+	running bool
+	last    int64 // nanoseconds
+	err     string
+	peers   int
+}
+
+// TorrentReannounce
+//
+// Announce torrent to all enabled trackers now, in background. Ignored for
+// stopped torrents.
+//
+//export TorrentReannounce
+func TorrentReannounce(i int) {
+	defaultSession.TorrentReannounce(i)
+}
+
+func (s *Session) TorrentReannounce(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+	for _, tier := range t.AnnounceList() {
+		for _, u := range tier {
+			s.reannounce(t, u)
+		}
+	}
+}
+
+// TorrentTrackerReannounce
+//
+// Announce torrent to one tracker now, in background. Ignored for stopped
+// torrents and disabled trackers.
+//
+//export TorrentTrackerReannounce
+func TorrentTrackerReannounce(i int, url string) {
+	defaultSession.TorrentTrackerReannounce(i, url)
+}
+
+func (s *Session) TorrentTrackerReannounce(i int, url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+	for _, tier := range t.AnnounceList() {
+		for _, u := range tier {
+			if u == url {
+				s.reannounce(t, u)
+			}
+		}
+	}
+}
+
+// torrent package has no way to force its announcers, announce ourself and
+// add returned peers. lock outside.
+func (s *Session) reannounce(t *torrent.Torrent, u string) {
+	if _, ok := s.active[t]; !ok || strings.HasPrefix(u, trackerDisabled) {
+		return
+	}
+	fs := s.filestorage[t.InfoHash()]
+	if fs.announces == nil {
+		fs.announces = make(map[string]*announceInfo)
+	}
+	ai := fs.announces[u]
+	if ai == nil {
+		ai = &announceInfo{}
+		fs.announces[u] = ai
+	}
+	if ai.running {
+		return
+	}
+	ai.running = true
+
+	left := int64(-1)
+	if t.Info() != nil {
+		left = t.BytesMissing()
+	}
+	stats := t.Stats()
+	a := tracker.Announce{
+		TrackerUrl: u,
+		UserAgent:  s.clientConfig.HTTPUserAgent,
+		HTTPProxy:  s.clientConfig.HTTPProxy,
+		Request: tracker.AnnounceRequest{
+			InfoHash:   t.InfoHash(),
+			PeerId:     s.client.PeerID(),
+			Downloaded: stats.BytesReadUsefulData.Int64(),
+			Uploaded:   stats.BytesWrittenData.Int64(),
+			Left:       left,
+			Key:        s.announceKey,
+			NumWant:    -1,
+			Port:       uint16(s.client.LocalPort()),
+		},
+	}
+	go s.announce(t, fs, a)
+}
+
+func (s *Session) announce(t *torrent.Torrent, fs *fileStorage, a tracker.Announce) {
+	res, err := a.Do()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ai := fs.announces[a.TrackerUrl]
+	if ai == nil { // tracker removed
+		return
+	}
+	ai.running = false
+	ai.last = time.Now().UnixNano()
+	if err != nil {
+		ai.err = err.Error()
+		ai.peers = 0
+		s.eventError(t, fmt.Errorf("%s: %s", a.TrackerUrl, err))
+		return
+	}
+	ai.err = ""
+	ai.peers = len(res.Peers)
+	if _, ok := s.active[t]; !ok { // stopped meanwhile
+		return
+	}
+	var pp []torrent.Peer
+	for _, p := range res.Peers {
+		pp = append(pp, torrent.Peer{IP: p.IP, Port: p.Port})
+	}
+	t.AddPeers(pp)
+}
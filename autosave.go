@@ -0,0 +1,109 @@
+package libtorrent
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+var AutosaveInterval = (1 * time.Minute).Nanoseconds() // see Config.AutosaveInterval
+
+// torrent state changed, save it on next autosave. lock outside.
+func (s *Session) stateChanged(t *torrent.Torrent) {
+	s.torrentstorageLock.Lock()
+	defer s.torrentstorageLock.Unlock()
+	if ts, ok := s.torrentstorage[t.InfoHash()]; ok {
+		ts.dirty = true
+	}
+}
+
+// mark states by hash dirty again, they failed to save
+func (s *Session) stateDirty(saves map[string]*torrentSave) {
+	s.torrentstorageLock.Lock()
+	defer s.torrentstorageLock.Unlock()
+	for hash := range saves {
+		if ts, ok := s.torrentstorage[metainfo.NewHashFromHex(hash)]; ok {
+			ts.dirty = true
+		}
+	}
+}
+
+// save changed torrents and session file into Config.AutosaveDir, same layout
+// as SaveSession(). 'all' - save every torrent (Pause, Close). errors reported
+// by EventListener.OnError with -1 index.
+func (s *Session) autosave(all bool) {
+	s.autosaveLock.Lock()
+	defer s.autosaveLock.Unlock()
+
+	s.mu.Lock()
+	if s.client == nil || s.cfg.AutosaveDir == "" {
+		s.mu.Unlock()
+		return
+	}
+	dir := s.cfg.AutosaveDir
+	state, saves := s.sessionState(!all, true)
+	s.mu.Unlock()
+
+	states, err := encodeStates(saves)
+	if err == nil {
+		err = s.autosaveWrite(dir, state, states)
+	}
+	if err != nil {
+		s.stateDirty(saves)
+		msg := err.Error()
+		s.emit(func(l EventListener) { l.OnError(-1, msg) })
+	}
+}
+
+func (s *Session) autosaveWrite(dir string, state *SessionState, states map[string][]byte) error {
+	buf, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if dir == s.autosaveDir && bytes.Equal(buf, s.autosaveSession) { // session file unchanged
+		if len(states) == 0 {
+			return nil
+		}
+		buf = nil
+	}
+	err = writeSession(dir, buf, states, state)
+	if err != nil {
+		return err
+	}
+	if buf != nil {
+		s.autosaveDir = dir
+		s.autosaveSession = buf
+	}
+	return nil
+}
+
+func (s *Session) autosaveEngine() {
+	s.mu.Lock()
+	if s.client == nil {
+		s.mu.Unlock()
+		return
+	}
+	clientClose := s.client.Wait()
+	s.mu.Unlock()
+
+	last := time.Now().UnixNano()
+	for {
+		select {
+		case <-clientClose:
+			return
+		case <-time.After(1 * time.Second):
+		}
+		s.mu.Lock()
+		interval := s.cfg.AutosaveInterval
+		s.mu.Unlock()
+		now := time.Now().UnixNano()
+		if now-last < interval {
+			continue
+		}
+		last = now
+		s.autosave(false)
+	}
+}
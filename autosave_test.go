@@ -0,0 +1,39 @@
+package libtorrent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAutosaveWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libtorrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s := &Session{}
+	state := &SessionState{Version: 1, UploadRate: 1}
+	p := filepath.Join(dir, sessionStateFile)
+
+	err = s.autosaveWrite(dir, state, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(p)
+	if err := s.autosaveWrite(dir, state, nil); err != nil { // unchanged, nothing written
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Error(err)
+	}
+	state.UploadRate = 2
+	if err := s.autosaveWrite(dir, state, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(p); err != nil {
+		t.Error(err)
+	}
+}
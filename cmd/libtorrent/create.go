@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/gitpubber/libtorrent"
+)
+
+type stringsFlag []string
+
+func (m *stringsFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *stringsFlag) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+func create(args []string) error {
+	f := flags("create", "path")
+	out := f.String("o", "", "output file, default: name.torrent")
+	var trackers stringsFlag
+	f.Var(&trackers, "t", "tracker url, can be repeated, default: built in list")
+	f.Parse(args)
+	if f.NArg() != 1 {
+		f.Usage()
+		os.Exit(2)
+	}
+	root, err := filepath.Abs(f.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = filepath.Base(root) + ".torrent"
+	}
+
+	s := libtorrent.DefaultSession() // metainfo builder works without client
+	if len(trackers) > 0 {
+		s.SetDefaultAnnouncesList(strings.Join(trackers, "\n"))
+	}
+
+	n := s.CreateMetainfo(root)
+	if n == -1 {
+		return errors.New(s.Error())
+	}
+	defer s.CloseMetaInfo()
+	for i := 0; i < n; i++ {
+		if !s.HashMetaInfo(i) {
+			return errors.New(s.Error())
+		}
+		fmt.Printf("\rhashing %d/%d", i+1, n)
+	}
+	fmt.Println()
+
+	buf := s.CreateTorrentFileFromMetaInfo()
+	if buf == nil {
+		return errors.New(s.Error())
+	}
+	return ioutil.WriteFile(*out, buf, 0644)
+}
+
+func loadMetainfo(args []string, name string) (*metainfo.MetaInfo, *metainfo.Info, error) {
+	f := flags(name, "file.torrent")
+	f.Parse(args)
+	if f.NArg() != 1 {
+		f.Usage()
+		os.Exit(2)
+	}
+	mi, err := metainfo.LoadFromFile(f.Arg(0))
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	return mi, &info, nil
+}
+
+func info(args []string) error {
+	mi, info, err := loadMetainfo(args, "info")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Name:         %s\n", info.Name)
+	fmt.Printf("Hash:         %s\n", mi.HashInfoBytes().HexString())
+	fmt.Printf("Size:         %s\n", formatSize(info.TotalLength()))
+	fmt.Printf("Pieces:       %d x %s\n", info.NumPieces(), formatSize(info.PieceLength))
+	if info.Private != nil && *info.Private {
+		fmt.Printf("Private:      yes\n")
+	}
+	if mi.Comment != "" {
+		fmt.Printf("Comment:      %s\n", mi.Comment)
+	}
+	if mi.CreatedBy != "" {
+		fmt.Printf("Created by:   %s\n", mi.CreatedBy)
+	}
+	if mi.CreationDate != 0 {
+		fmt.Printf("Created on:   %s\n", time.Unix(mi.CreationDate, 0).Format(time.RFC1123))
+	}
+	fmt.Printf("Trackers:\n")
+	for _, tier := range mi.UpvertedAnnounceList() {
+		fmt.Printf("  %s\n", strings.Join(tier, " "))
+	}
+	if len(mi.UrlList) > 0 {
+		fmt.Printf("Web seeds:\n")
+		for _, u := range mi.UrlList {
+			fmt.Printf("  %s\n", u)
+		}
+	}
+	fmt.Printf("Files:\n")
+	for _, fi := range info.UpvertedFiles() {
+		p := strings.Join(append([]string{info.Name}, fi.Path...), "/")
+		fmt.Printf("  %s (%s)\n", p, formatSize(fi.Length))
+	}
+	return nil
+}
+
+func magnet(args []string) error {
+	mi, info, err := loadMetainfo(args, "magnet")
+	if err != nil {
+		return err
+	}
+	fmt.Println(mi.Magnet(info.Name, mi.HashInfoBytes()).String())
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gitpubber/libtorrent"
+	"github.com/gitpubber/libtorrent/rpc"
+)
+
+func daemon(args []string) error {
+	f := flags("daemon", "")
+	dir := f.String("d", ".", "download folder for new torrents")
+	states := f.String("s", "", "state folder, default: download folder/.libtorrent")
+	bind := f.String("bind", "", "listen address, default "+libtorrent.BindAddr)
+	rpcAddr := f.String("rpc", "127.0.0.1:9091", "Transmission RPC address, empty to disable")
+	httpAddr := f.String("http", "", "HTTP streaming server address, empty to disable")
+	save := f.Duration("save", time.Minute, "states save interval")
+	f.Parse(args)
+
+	if *states == "" {
+		*states = filepath.Join(*dir, ".libtorrent")
+	}
+	err := os.MkdirAll(*states, 0755)
+	if err != nil {
+		return err
+	}
+
+	s, err := newSession(*bind)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	err = s.LoadSessionE(*states)
+	if err != nil && !os.IsNotExist(err) {
+		log.Println(err)
+	}
+
+	if *rpcAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/transmission/rpc", rpc.NewServer(s, *dir))
+		go func() {
+			log.Fatal(http.ListenAndServe(*rpcAddr, mux))
+		}()
+		log.Println("rpc listening on", *rpcAddr)
+	}
+	if *httpAddr != "" {
+		err = s.StartHTTPServerE(*httpAddr)
+		if err != nil {
+			return err
+		}
+		log.Println("http listening on", s.HTTPServerAddr())
+	}
+
+	c := interrupt()
+	for {
+		select {
+		case <-c:
+			return s.SaveSessionE(*states)
+		case <-time.After(*save):
+			err = s.SaveSessionE(*states)
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gitpubber/libtorrent"
+)
+
+var statusNames = map[int32]string{
+	libtorrent.StatusPaused:      "paused",
+	libtorrent.StatusDownloading: "downloading",
+	libtorrent.StatusSeeding:     "seeding",
+	libtorrent.StatusChecking:    "checking",
+	libtorrent.StatusQueued:      "queued",
+	libtorrent.StatusForced:      "forced",
+}
+
+func interrupt() chan os.Signal {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	return c
+}
+
+// downloaded, all selected files
+func completed(s *libtorrent.Session, i int) bool {
+	return s.MetaTorrent(i) && s.PendingCompleted(i)
+}
+
+func progress(s *libtorrent.Session, i int) string {
+	name := s.TorrentName(i)
+	status := statusNames[s.TorrentStatus(i)]
+	if !s.MetaTorrent(i) {
+		return fmt.Sprintf("%s: %s, downloading metadata, peers %d", name, status, s.TorrentPeersCount(i))
+	}
+	done := s.TorrentPendingBytesCompleted(i)
+	total := s.TorrentPendingBytesLength(i)
+	percent := 100.0
+	if total > 0 {
+		percent = float64(done) * 100 / float64(total)
+	}
+	eta := "-"
+	if e := s.TorrentETA(i); e > 0 {
+		eta = time.Duration(e).Round(time.Second).String()
+	}
+	return fmt.Sprintf("%s: %s, %.1f%% of %s, down %s/s, up %s/s, peers %d, eta %s", name, status, percent, formatSize(total),
+		formatSize(s.TorrentDownloadRate(i)), formatSize(s.TorrentUploadRate(i)), s.TorrentPeersCount(i), eta)
+}
+
+// print progress every second until 'done' or interrupted
+func watch(s *libtorrent.Session, ii []int, done func() bool) {
+	c := interrupt()
+	for {
+		for _, i := range ii {
+			fmt.Println(progress(s, i))
+		}
+		if done() {
+			return
+		}
+		select {
+		case <-c:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func download(args []string) error {
+	f := flags("download", "magnet|url|file.torrent ...")
+	dir := f.String("d", ".", "download folder")
+	bind := f.String("bind", "", "listen address, default "+libtorrent.BindAddr)
+	f.Parse(args)
+	if f.NArg() == 0 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	s, err := newSession(*bind)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	var ii []int
+	for _, a := range f.Args() {
+		i, err := add(s, *dir, a)
+		if err != nil {
+			return fmt.Errorf("%s: %s", a, err)
+		}
+		err = s.StartTorrentE(i)
+		if err != nil {
+			return err
+		}
+		ii = append(ii, i)
+	}
+
+	watch(s, ii, func() bool {
+		for _, i := range ii {
+			if !completed(s, i) {
+				return false
+			}
+		}
+		return true
+	})
+	return nil
+}
+
+// wait for CheckTorrent() done
+func checkWait(s *libtorrent.Session, i int) {
+	for s.TorrentStatus(i) == libtorrent.StatusChecking {
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func seed(args []string) error {
+	f := flags("seed", "file.torrent ...")
+	dir := f.String("d", ".", "folder with downloaded data")
+	bind := f.String("bind", "", "listen address, default "+libtorrent.BindAddr)
+	f.Parse(args)
+	if f.NArg() == 0 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	s, err := newSession(*bind)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	var ii []int
+	for _, a := range f.Args() {
+		i, err := add(s, *dir, a)
+		if err != nil {
+			return fmt.Errorf("%s: %s", a, err)
+		}
+		s.CheckTorrent(i)
+		checkWait(s, i)
+		if !completed(s, i) {
+			fmt.Fprintf(os.Stderr, "%s: data incomplete, seeding available pieces\n", s.TorrentName(i))
+		}
+		err = s.ForceStartTorrentE(i) // seed all, ignore active limits
+		if err != nil {
+			return err
+		}
+		ii = append(ii, i)
+	}
+
+	watch(s, ii, func() bool { return false })
+	return nil
+}
+
+func check(args []string) error {
+	f := flags("check", "file.torrent")
+	dir := f.String("d", ".", "folder with downloaded data")
+	f.Parse(args)
+	if f.NArg() != 1 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	s, err := newSession(":0")
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	i, err := add(s, *dir, f.Arg(0))
+	if err != nil {
+		return err
+	}
+	s.CheckTorrent(i)
+	checkWait(s, i)
+
+	done := s.TorrentBytesCompleted(i)
+	total := s.TorrentBytesLength(i)
+	fmt.Printf("%s: %s of %s verified\n", s.TorrentName(i), formatSize(done), formatSize(total))
+	if done < total {
+		return fmt.Errorf("%s missing or corrupted", formatSize(total-done))
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+// libtorrent command line client.
+//
+//	libtorrent create [-o file.torrent] [-t tracker] path
+//	libtorrent info file.torrent
+//	libtorrent magnet file.torrent
+//	libtorrent download [-d dir] magnet|url|file.torrent ...
+//	libtorrent seed [-d dir] file.torrent ...
+//	libtorrent check [-d dir] file.torrent
+//	libtorrent daemon [-d dir] [-s statedir] [-rpc addr] [-http addr]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/gitpubber/libtorrent"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"create", "create torrent file from file or folder", create},
+	{"info", "print torrent file info and files list", info},
+	{"magnet", "print torrent file magnet link", magnet},
+	{"download", "download torrents", download},
+	{"seed", "check and seed downloaded torrents", seed},
+	{"check", "check torrent files consistency", check},
+	{"daemon", "run torrent client with Transmission RPC, keep states between restarts", daemon},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: libtorrent command [arguments]\n\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			err := c.run(os.Args[2:])
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "libtorrent:", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+}
+
+func flags(name string, args string) *flag.FlagSet {
+	f := flag.NewFlagSet(name, flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: libtorrent %s [flags] %s\n", name, args)
+		f.PrintDefaults()
+	}
+	return f
+}
+
+// session with flags set, caller should Close() it
+func newSession(bind string) (*libtorrent.Session, error) {
+	cfg := libtorrent.NewConfig()
+	if bind != "" {
+		cfg.BindAddr = bind
+	}
+	return libtorrent.NewSession(cfg)
+}
+
+// add magnet, http url or .torrent file
+func add(s *libtorrent.Session, dir string, arg string) (int, error) {
+	switch {
+	case strings.HasPrefix(arg, "magnet:"):
+		return s.AddMagnetE(dir, arg)
+	case strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://"):
+		return s.AddTorrentFromURLE(dir, arg)
+	}
+	buf, err := ioutil.ReadFile(arg)
+	if err != nil {
+		return -1, err
+	}
+	return s.AddTorrentFromBytesE(dir, buf)
+}
+
+func formatSize(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,227 @@
+package libtorrent
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+)
+
+// Config
+//
+// Session settings. NewConfig() fills it with defaults from package variables
+// (BindAddr, SocketsPerTorrent, ActiveCount, etc.) and constants.
+//
+// BindAddr, SocketsPerTorrent, Version and Bep20 are used at Create() time
+// only, rest can be changed by ApplyConfig() on running session.
+type Config struct {
+	BindAddr          string `json:"bind_addr"`
+	SocketsPerTorrent int    `json:"sockets_per_torrent"`
+	Version           string `json:"version,omitempty"`
+	Bep20             string `json:"bep20,omitempty"`
+
+	UploadRate          int   `json:"upload_rate"`      // bytes per second, 0 - unlimited
+	DownloadRate        int   `json:"download_rate"`    // bytes per second, 0 - unlimited
+	ActiveDownloads     int   `json:"active_downloads"` // 0 - unlimited
+	ActiveSeeds         int   `json:"active_seeds"`     // 0 - unlimited
+	ActiveTotal         int   `json:"active_total"`     // 0 - unlimited
+	QueueTimeout        int64 `json:"queue_timeout"`    // nanoseconds
+	RefreshPort         int64 `json:"refresh_port"`     // nanoseconds
+	WebSeedConcurent    int   `json:"webseed_concurent"`
+	WebSeedUrlConcurent int   `json:"webseed_url_concurent"`
+	LPDShortTimeout     int64 `json:"lpd_short_timeout"` // nanoseconds
+
+	// slow torrents do not hold active slots. bytes per second, 0 - disabled
+	SlowDownloadRate int   `json:"slow_download_rate"`
+	SlowUploadRate   int   `json:"slow_upload_rate"`
+	SlowWindow       int64 `json:"slow_window"` // nanoseconds
+
+	SeedRatio  float64 `json:"seed_ratio"` // 0 - unlimited
+	SeedTime   int64   `json:"seed_time"`  // nanoseconds, 0 - unlimited
+	SeedAction int32   `json:"seed_action"`
+
+	StreamingReadahead int64 `json:"streaming_readahead"` // bytes, sequential / streaming window
+
+	// save changed torrents states into folder (SaveSession layout), empty - disabled
+	AutosaveDir      string `json:"autosave_dir,omitempty"`
+	AutosaveInterval int64  `json:"autosave_interval"` // nanoseconds
+}
+
+func NewConfig() *Config {
+	return &Config{
+		BindAddr:            BindAddr,
+		SocketsPerTorrent:   SocketsPerTorrent,
+		Version:             Version,
+		Bep20:               Bep20,
+		ActiveDownloads:     ActiveDownloads,
+		ActiveSeeds:         ActiveSeeds,
+		ActiveTotal:         ActiveCount,
+		QueueTimeout:        QueueTimeout,
+		RefreshPort:         RefreshPort,
+		WebSeedConcurent:    WEBSEED_CONCURENT,
+		WebSeedUrlConcurent: WEBSEED_URL_CONCURENT,
+		LPDShortTimeout:     bep14_short_timeout.Nanoseconds(),
+		SlowWindow:          RateWindowLong,
+		SeedAction:          SeedActionPause,
+		StreamingReadahead:  StreamingReadahead,
+		AutosaveInterval:    AutosaveInterval,
+	}
+}
+
+// ConfigFromJSON
+//
+// Parse config saved by Config.JSON(). Missing fields keep default values.
+func ConfigFromJSON(buf []byte) (*Config, error) {
+	cfg := NewConfig()
+	err := json.Unmarshal(buf, cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (m *Config) JSON() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+func (m *Config) Validate() error {
+	if m.BindAddr != "" {
+		if _, _, err := net.SplitHostPort(m.BindAddr); err != nil {
+			return err
+		}
+	}
+	if m.SocketsPerTorrent <= 0 {
+		return errors.New("sockets per torrent must be positive")
+	}
+	if m.UploadRate < 0 || m.DownloadRate < 0 {
+		return errors.New("rate can't be negative")
+	}
+	if m.ActiveDownloads < 0 || m.ActiveSeeds < 0 || m.ActiveTotal < 0 {
+		return errors.New("active limits can't be negative")
+	}
+	if m.QueueTimeout <= 0 {
+		return errors.New("queue timeout must be positive")
+	}
+	if m.RefreshPort <= 0 {
+		return errors.New("refresh port must be positive")
+	}
+	if m.WebSeedConcurent <= 0 || m.WebSeedUrlConcurent <= 0 {
+		return errors.New("webseed concurent must be positive")
+	}
+	if m.LPDShortTimeout <= 0 {
+		return errors.New("lpd short timeout must be positive")
+	}
+	if m.SlowDownloadRate < 0 || m.SlowUploadRate < 0 {
+		return errors.New("slow rates can't be negative")
+	}
+	if m.SlowWindow <= 0 {
+		return errors.New("slow window must be positive")
+	}
+	if m.SeedRatio < 0 || m.SeedTime < 0 {
+		return errors.New("seed limits can't be negative")
+	}
+	switch m.SeedAction {
+	case SeedActionPause, SeedActionRemove, SeedActionRemoveData:
+	default:
+		return errors.New("unknown seed action")
+	}
+	if m.StreamingReadahead <= 0 {
+		return errors.New("streaming readahead must be positive")
+	}
+	if m.AutosaveInterval <= 0 {
+		return errors.New("autosave interval must be positive")
+	}
+	return nil
+}
+
+func (m *Config) copy() *Config {
+	c := *m
+	return &c
+}
+
+// CreateWithConfig
+//
+// Create libtorrent object with given settings
+func CreateWithConfig(cfg *Config) bool {
+	err := cfg.Validate()
+	if err != nil {
+		defaultSession.setError(err)
+		return false
+	}
+
+	defaultSession.mu.Lock()
+	defaultSession.cfg = cfg.copy()
+	defaultSession.mu.Unlock()
+
+	return defaultSession.create()
+}
+
+// GetConfig
+//
+// Copy of current session settings
+func GetConfig() *Config {
+	return defaultSession.GetConfig()
+}
+
+func (s *Session) GetConfig() *Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg.copy()
+}
+
+// ApplyConfig
+//
+// Change runtime settings without client restart: rates, active limits, queue
+// timeout, port refresh, webseeds, lpd, seed limits, streaming and autosave.
+// Create() time settings ignored.
+func ApplyConfig(cfg *Config) error {
+	return defaultSession.ApplyConfig(cfg)
+}
+
+func (s *Session) ApplyConfig(cfg *Config) error {
+	err := cfg.Validate()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.cfg.copy()
+	c.UploadRate = cfg.UploadRate
+	c.DownloadRate = cfg.DownloadRate
+	c.ActiveDownloads = cfg.ActiveDownloads
+	c.ActiveSeeds = cfg.ActiveSeeds
+	c.ActiveTotal = cfg.ActiveTotal
+	c.SlowDownloadRate = cfg.SlowDownloadRate
+	c.SlowUploadRate = cfg.SlowUploadRate
+	c.SlowWindow = cfg.SlowWindow
+	c.QueueTimeout = cfg.QueueTimeout
+	c.RefreshPort = cfg.RefreshPort
+	c.WebSeedConcurent = cfg.WebSeedConcurent
+	c.WebSeedUrlConcurent = cfg.WebSeedUrlConcurent
+	c.LPDShortTimeout = cfg.LPDShortTimeout
+	c.SeedRatio = cfg.SeedRatio
+	c.SeedTime = cfg.SeedTime
+	c.SeedAction = cfg.SeedAction
+	c.StreamingReadahead = cfg.StreamingReadahead
+	c.AutosaveDir = cfg.AutosaveDir
+	c.AutosaveInterval = cfg.AutosaveInterval
+	s.cfg = c
+
+	if s.client == nil { // not created yet
+		return nil
+	}
+
+	s.client.Config(func() { s.clientConfig.DownloadRateLimiter = limit(c.DownloadRate) })
+	s.uploadLimitUpdate()
+
+	s.queueFill() // active limits increased? start queued torrents
+
+	s.eventStatus()
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package libtorrent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfigJSON(t *testing.T) {
+	c := NewConfig()
+	c.ActiveDownloads = 7
+	c.UploadRate = 1024
+
+	buf, err := c.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := ConfigFromJSON(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c, c2) {
+		t.Error(c, c2)
+	}
+
+	c2, err = ConfigFromJSON([]byte(`{"active_total":-1}`))
+	if err == nil {
+		t.Error("invalid config accepted", c2)
+	}
+}
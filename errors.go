@@ -0,0 +1,24 @@
+package libtorrent
+
+import (
+	"errors"
+)
+
+// errors returned by E functions (AddMagnetE, LoadTorrentE, etc.), check them
+// with errors.Is()
+var (
+	ErrAlreadyExists  = errors.New("Already exists")
+	ErrNoMetadata     = errors.New("no metadata")
+	ErrUnknownTorrent = errors.New("unknown torrent")
+	ErrMoving         = errors.New("torrent data is moving")
+	ErrPriority       = errors.New("unknown file priority")
+	ErrSeedAction     = errors.New("unknown seed action")
+	ErrUnknownFile    = errors.New("unknown file")
+	ErrBadFileName    = errors.New("bad file name")
+	ErrClosed         = errors.New("closed")
+	ErrBadResume      = errors.New("bad resume data")
+	ErrBadState       = errors.New("bad state")
+	ErrStateVersion   = errors.New("unsupported state version")
+	ErrUnknownTracker = errors.New("unknown tracker")
+	ErrBadTracker     = errors.New("bad tracker url")
+)
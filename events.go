@@ -0,0 +1,135 @@
+package libtorrent
+
+import (
+	"github.com/anacrolix/torrent"
+)
+
+// EventListener
+//
+// Torrent lifecycle callbacks, so application do not need to poll
+// TorrentStatus(). Callbacks are called from separate goroutine, in the same
+// order events happend, and it is safe to call library functions from them.
+type EventListener interface {
+	OnMetadata(i int)                      // torrent metadata received (magnet link or DownloadMetadata)
+	OnStatusChanged(i int, old, new int32) // Status* constant changed
+	OnCompleted(i int)                     // all selected files downloaded
+	OnError(i int, msg string)             // webseed / tracker / start errors, -1 - autosave errors
+}
+
+// SetEventListener
+//
+// Set listener for torrent events, nil to remove.
+//
+//export SetEventListener
+func SetEventListener(l EventListener) {
+	defaultSession.SetEventListener(l)
+}
+
+func (s *Session) SetEventListener(l EventListener) {
+	s.eventsLock.Lock()
+	defer s.eventsLock.Unlock()
+
+	s.listener = l
+
+	if s.eventsWake == nil {
+		s.eventsWake = make(chan struct{}, 1)
+		go s.eventsLoop()
+	}
+}
+
+// events generated under 's.mu' lock, we can't call listener directly, it can
+// call us back. queue them and deliver from eventsLoop.
+func (s *Session) emit(f func(l EventListener)) {
+	s.eventsLock.Lock()
+	defer s.eventsLock.Unlock()
+
+	if s.listener == nil {
+		return
+	}
+
+	s.events = append(s.events, f)
+
+	select {
+	case s.eventsWake <- struct{}{}:
+	default: // already pending
+	}
+}
+
+// stop eventsLoop, pending events dropped
+func (s *Session) eventsStop() {
+	s.eventsLock.Lock()
+	defer s.eventsLock.Unlock()
+
+	s.listener = nil
+	s.events = nil
+
+	if s.eventsWake != nil {
+		close(s.eventsWake)
+		s.eventsWake = nil
+	}
+}
+
+func (s *Session) eventsLoop() {
+	for range s.eventsWake {
+		s.eventsLock.Lock()
+		ee := s.events
+		s.events = nil
+		l := s.listener
+		s.eventsLock.Unlock()
+
+		if l == nil {
+			continue
+		}
+		for _, f := range ee {
+			f(l)
+		}
+	}
+}
+
+func (s *Session) torrentIndex(t *torrent.Torrent) int {
+	for i, m := range s.torrents {
+		if m == t {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Session) eventMetadata(t *torrent.Torrent) {
+	i := s.torrentIndex(t)
+	if i == -1 {
+		return
+	}
+	s.emit(func(l EventListener) { l.OnMetadata(i) })
+}
+
+func (s *Session) eventCompleted(t *torrent.Torrent) {
+	i := s.torrentIndex(t)
+	if i == -1 {
+		return
+	}
+	s.emit(func(l EventListener) { l.OnCompleted(i) })
+}
+
+func (s *Session) eventError(t *torrent.Torrent, err error) {
+	i := s.torrentIndex(t)
+	if i == -1 {
+		return
+	}
+	msg := err.Error()
+	s.emit(func(l EventListener) { l.OnError(i, msg) })
+}
+
+// compare torrents status with last known and report changes. call it after
+// active / queue / pause maps modified.
+func (s *Session) eventStatus() {
+	for i, t := range s.torrents {
+		status := s.torrentStatus(t)
+		old, ok := s.status[t]
+		s.status[t] = status
+		if ok && old != status {
+			i := i
+			s.emit(func(l EventListener) { l.OnStatusChanged(i, old, status) })
+		}
+	}
+}
@@ -2,6 +2,7 @@ package libtorrent
 
 import (
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -14,24 +15,32 @@ import (
 
 type File struct {
 	Check          bool
+	Priority       int32 // FilePriority*
 	Path           string
 	Length         int64
 	BytesCompleted int64
 }
 
 func TorrentFilesCount(i int) int {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.TorrentFilesCount(i)
+}
+
+func (s *Session) TorrentFilesCount(i int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	t := torrents[i]
-	fs := filestorage[t.InfoHash()]
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
+	fs := s.filestorage[t.InfoHash()]
 
-	fs.Files = torrentFiles(t)
+	fs.Files = s.torrentFiles(t)
 
 	return len(fs.Files)
 }
 
-func torrentFiles(t *torrent.Torrent) []File {
+func (s *Session) torrentFiles(t *torrent.Torrent) []File {
 	info := t.Info()
 	if info == nil {
 		return nil
@@ -42,22 +51,27 @@ func torrentFiles(t *torrent.Torrent) []File {
 	//
 	// library -> torrentstorageLock
 	// net -> torrent -> storage -> torrentstorageLock
-	torrentstorageLock.Lock()
-	ts := torrentstorage[t.InfoHash()]
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[t.InfoHash()]
 	checks := ts.Checks()
-	torrentstorageLock.Unlock()
+	priorities := ts.Priorities()
+	root := ts.rootName()
+	renames := make(map[int]string)
+	for k, v := range ts.files {
+		renames[k] = v
+	}
+	s.torrentstorageLock.Unlock()
 
 	var files []File
 
-	root := ts.root
-	if root == "" {
-		root = info.Name
-	}
-
 	for i, v := range *t.GetFiles(root) {
 		p := File{}
 		p.Check = checks[i]
+		p.Priority = priorities[i]
 		p.Path = v.Path()
+		if n, ok := renames[i]; ok {
+			p.Path = root + "/" + n
+		}
 		v.Offset()
 		p.Length = v.Length()
 
@@ -97,55 +111,76 @@ func torrentFiles(t *torrent.Torrent) []File {
 
 // return torrent files array
 func TorrentFiles(i int, p int) *File {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.TorrentFiles(i, p)
+}
+
+func (s *Session) TorrentFiles(i int, p int) *File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	t := torrents[i]
-	fs := filestorage[t.InfoHash()]
+	t, err := s.lookup(i)
+	if err != nil {
+		return nil
+	}
+	fs := s.filestorage[t.InfoHash()]
 	return &fs.Files[p]
 }
 
 func TorrentFilesCheck(i int, p int, b bool) {
-	mu.Lock()
-	defer mu.Unlock()
+	defaultSession.TorrentFilesCheck(i, p, b)
+}
 
-	t := torrents[i]
-	fs := filestorage[t.InfoHash()]
+func (s *Session) TorrentFilesCheck(i int, p int, b bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+	fs := s.filestorage[t.InfoHash()]
 
 	// update dynamic data
 	ff := fs.Files[p]
 	ff.Check = b
 
-	torrentstorageLock.Lock()
-	ts := torrentstorage[t.InfoHash()]
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[t.InfoHash()]
 	ts.checks[p] = b
-	torrentstorageLock.Unlock()
+	s.torrentstorageLock.Unlock()
 
-	fileUpdateCheck(t)
+	s.fileUpdateCheck(t)
 }
 
 func TorrentFilesCheckAll(i int, b bool) {
-	mu.Lock()
-	defer mu.Unlock()
+	defaultSession.TorrentFilesCheckAll(i, b)
+}
 
-	t := torrents[i]
-	fs := filestorage[t.InfoHash()]
+func (s *Session) TorrentFilesCheckAll(i int, b bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+	fs := s.filestorage[t.InfoHash()]
 
 	files := fs.Files
 	if files == nil {
-		files = torrentFiles(t)
+		files = s.torrentFiles(t)
 	}
 
-	torrentstorageLock.Lock()
-	ts := torrentstorage[t.InfoHash()]
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[t.InfoHash()]
 	for p := 0; p < len(files); p++ {
 		ff := files[p]
 		ff.Check = b
 		ts.checks[p] = b
 	}
-	torrentstorageLock.Unlock()
+	s.torrentstorageLock.Unlock()
 
-	fileUpdateCheck(t)
+	s.fileUpdateCheck(t)
 }
 
 // https://stackoverflow.com/questions/28734455/java-converting-file-pattern-to-regular-expression-pattern
@@ -171,21 +206,28 @@ func wildcardToRegex(wildcard string) string {
 }
 
 func TorrentFilesCheckFilter(i int, filter string, b bool) {
-	mu.Lock()
-	defer mu.Unlock()
+	defaultSession.TorrentFilesCheckFilter(i, filter, b)
+}
 
-	t := torrents[i]
-	fs := filestorage[t.InfoHash()]
+func (s *Session) TorrentFilesCheckFilter(i int, filter string, b bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+	fs := s.filestorage[t.InfoHash()]
 
 	m := regexp.MustCompile(wildcardToRegex(strings.ToLower(filter)))
 
 	files := fs.Files
 	if files == nil {
-		files = torrentFiles(t)
+		files = s.torrentFiles(t)
 	}
 
-	torrentstorageLock.Lock()
-	ts := torrentstorage[t.InfoHash()]
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[t.InfoHash()]
 	for p := 0; p < len(files); p++ {
 		ff := files[p]
 		if m.MatchString(strings.ToLower(ff.Path)) {
@@ -193,73 +235,213 @@ func TorrentFilesCheckFilter(i int, filter string, b bool) {
 			ts.checks[p] = b // storage
 		}
 	}
-	torrentstorageLock.Unlock()
+	s.torrentstorageLock.Unlock()
 
-	fileUpdateCheck(t)
+	s.fileUpdateCheck(t)
 }
 
 // TorrentFileRename
 //
-// To implement this we need to keep two Metainfo one for network operations,
-// and second for local file storage.
+// Rename / move torrent file 'f' inside torrent folder, 'n' is new path relative
+// to torrent folder ('/' separated). Network operations keep original
+// metainfo names, local storage uses renamed path. Renaming single file
+// torrent is the same as TorrentRename.
 //
 //export TorrentFileRename
 func TorrentFileRename(i int, f int, n string) bool {
-	panic("not implement")
+	return defaultSession.TorrentFileRename(i, f, n)
+}
+
+func (s *Session) TorrentFileRename(i int, f int, n string) bool {
+	err := s.TorrentFileRenameE(i, f, n)
+	s.setError(err)
+	return err == nil
+}
+
+func TorrentFileRenameE(i int, f int, n string) error {
+	return defaultSession.TorrentFileRenameE(i, f, n)
+}
+
+func (s *Session) TorrentFileRenameE(i int, f int, n string) error {
+	s.mu.Lock()
+	t, err := s.lookup(i)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	info := t.Info()
+	if info == nil {
+		s.mu.Unlock()
+		return ErrNoMetadata
+	}
+	if len(info.Files) == 0 { // single file torrent
+		s.mu.Unlock()
+		return s.TorrentRenameE(i, n)
+	}
+	defer s.mu.Unlock()
+
+	files := info.UpvertedFiles()
+	if f < 0 || f >= len(files) {
+		return ErrUnknownFile
+	}
+
+	p := path.Clean(strings.Replace(n, "\\", "/", -1))
+	if p == "." || path.IsAbs(p) || p == ".." || strings.HasPrefix(p, "../") {
+		return ErrBadFileName
+	}
+
+	hash := t.InfoHash()
+
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[hash]
+	s.torrentstorageLock.Unlock()
+
+	// pause storage io, so no write recreates file at old path
+	ts.ioLock.Lock()
+	defer ts.ioLock.Unlock()
+
+	s.torrentstorageLock.Lock()
+	defer s.torrentstorageLock.Unlock()
+
+	fi := files[f]
+
+	old := ts.fileRel(f, fi)
+	rel := filepath.Join(append([]string{ts.rootName()}, strings.Split(p, "/")...)...)
+
+	if old == rel {
+		return nil
+	}
+
+	for k, v := range files { // do not overwrite other torrent files
+		if k != f && ts.fileRel(k, v) == rel {
+			return ErrAlreadyExists
+		}
+	}
+
+	if s.storageExternal != nil {
+		err = s.storageExternal.Rename(hash.HexString(), old, rel)
+		if err != nil {
+			return err
+		}
+	} else {
+		oldPath := filepath.Join(ts.path, old)
+		if _, err := os.Stat(oldPath); err == nil {
+			newPath := filepath.Join(ts.path, rel)
+			err = os.MkdirAll(filepath.Dir(newPath), 0770)
+			if err != nil {
+				return err
+			}
+			err = os.Rename(oldPath, newPath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if ts.files == nil {
+		ts.files = make(map[int]string)
+	}
+	ts.files[f] = p
+	ts.dirty = true
+
+	orig := fi.Path
+	if len(fi.PathUTF8) != 0 {
+		orig = fi.PathUTF8
+	}
+	if strings.Join(orig, "/") == p { // renamed back
+		delete(ts.files, f)
+	}
+
+	return nil
 }
 
 func TorrentSetName(i int, n string) {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
+	defaultSession.TorrentSetName(i, n)
+}
+
+func (s *Session) TorrentSetName(i int, n string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
 
-	torrentstorageLock.Lock()
-	defer torrentstorageLock.Unlock()
+	s.torrentstorageLock.Lock()
+	defer s.torrentstorageLock.Unlock()
 
-	ts := torrentstorage[t.InfoHash()]
+	ts := s.torrentstorage[t.InfoHash()]
 	ts.root = n
+	ts.dirty = true
 }
 
 func TorrentRename(i int, n string) bool {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
+	return defaultSession.TorrentRename(i, n)
+}
 
-	hash := t.InfoHash()
+func (s *Session) TorrentRename(i int, n string) bool {
+	err := s.TorrentRenameE(i, n)
+	s.setError(err)
+	return err == nil
+}
 
-	torrentstorageLock.Lock()
-	defer torrentstorageLock.Unlock()
+func TorrentRenameE(i int, n string) error {
+	return defaultSession.TorrentRenameE(i, n)
+}
+
+func (s *Session) TorrentRenameE(i int, n string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	ts := torrentstorage[t.InfoHash()]
-	name := ts.root
-	if name == "" {
-		name = ts.info.Name
+	t, err := s.lookup(i)
+	if err != nil {
+		return err
 	}
-	if storageExternal != nil {
-		err = storageExternal.Rename(hash.HexString(), name, n)
+	if t.Info() == nil {
+		return ErrNoMetadata
+	}
+
+	hash := t.InfoHash()
+
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[hash]
+	s.torrentstorageLock.Unlock()
+
+	ts.ioLock.Lock() // pause storage io
+	defer ts.ioLock.Unlock()
+
+	s.torrentstorageLock.Lock()
+	defer s.torrentstorageLock.Unlock()
+
+	name := ts.rootName()
+	if s.storageExternal != nil {
+		err = s.storageExternal.Rename(hash.HexString(), name, n)
 		if err != nil {
-			return false
+			return err
 		}
 	} else {
 		old := filepath.Join(ts.path, name)
 		if _, err := os.Stat(old); err == nil {
 			err = os.Rename(old, filepath.Join(ts.path, n))
 			if err != nil {
-				return false
+				return err
 			}
 		}
 	}
 	ts.root = n
-	return true
+	ts.dirty = true
+	return nil
 }
 
-func fileUpdateCheck(t *torrent.Torrent) {
-	fs := filestorage[t.InfoHash()]
+func (s *Session) fileUpdateCheck(t *torrent.Torrent) {
+	s.stateChanged(t) // checks or priorities changed
+
+	fs := s.filestorage[t.InfoHash()]
 
 	seeding := false
 	downloading := false
 
-	if _, ok := active[t]; ok {
+	if _, ok := s.active[t]; ok {
 		pp := t.GetPendingPieces()
 		if pendingBytesCompleted(t, &pp) >= pendingBytesLength(t, &pp) {
 			seeding = true
@@ -270,19 +452,22 @@ func fileUpdateCheck(t *torrent.Torrent) {
 
 	// do not clear 'completedPieces', and do not pend completed onces. we need to update pieces one by one.
 	t.CancelPieces(0, t.NumPieces())
-	fb := filePendingBitmap(t.InfoHash())
+	fb := s.filePendingBitmap(t.InfoHash())
 	fb.IterTyped(func(piece int) (more bool) {
 		t.DownloadPieces(piece, piece+1)
 		return true
 	})
+	s.filePriorityUpdate(t)
+	fs.streamPieces = nil // all pieces been reset
+	s.streamingUpdate(t)
 
 	now := time.Now().UnixNano()
 
 	if pendingBytesCompleted(t, fb) < pendingBytesLength(t, fb) { // now we downloading
-		torrentstorageLock.Lock()
-		ts := torrentstorage[t.InfoHash()]
+		s.torrentstorageLock.Lock()
+		ts := s.torrentstorage[t.InfoHash()]
 		ts.completed = false
-		torrentstorageLock.Unlock()
+		s.torrentstorageLock.Unlock()
 
 		fs.CompletedDate = 0
 		// did we seed before? update seed timer
@@ -291,8 +476,8 @@ func fileUpdateCheck(t *torrent.Torrent) {
 			fs.ActivateDate = now
 		}
 
-		if _, ok := active[t]; ok {
-			webSeedStart(t)
+		if _, ok := s.active[t]; ok {
+			s.webSeedStart(t)
 		}
 	} else { // now we seeding
 		// did we download before? update downloading timer then
@@ -300,16 +485,18 @@ func fileUpdateCheck(t *torrent.Torrent) {
 			fs.DownloadingTime = fs.DownloadingTime + (now - fs.ActivateDate)
 			fs.ActivateDate = now
 		}
-		webSeedStop(t)
+		s.webSeedStop(t)
 	}
 
 	t.UpdatePiecePriorities()
+
+	s.eventStatus()
 }
 
-func filePendingBitmap(infoHash metainfo.Hash) *bitmap.Bitmap {
-	torrentstorageLock.Lock()
-	defer torrentstorageLock.Unlock()
-	ts := torrentstorage[infoHash]
+func (s *Session) filePendingBitmap(infoHash metainfo.Hash) *bitmap.Bitmap {
+	s.torrentstorageLock.Lock()
+	defer s.torrentstorageLock.Unlock()
+	ts := s.torrentstorage[infoHash]
 	return filePendingBitmapTs(ts.info, ts.checks)
 }
 
@@ -334,20 +521,27 @@ func filePendingBitmapTs(info *metainfo.Info, checks []bool) *bitmap.Bitmap {
 }
 
 func PendingCompleted(i int) bool {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.PendingCompleted(i)
+}
 
-	t := torrents[i]
-	return pendingCompleted(t)
+func (s *Session) PendingCompleted(i int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return false
+	}
+	return s.pendingCompleted(t)
 }
 
-func pendingCompleted(t *torrent.Torrent) bool {
+func (s *Session) pendingCompleted(t *torrent.Torrent) bool {
 	info := t.Info()
 	if info == nil {
 		return false
 	}
 
-	fb := filePendingBitmap(t.InfoHash())
+	fb := s.filePendingBitmap(t.InfoHash())
 	return pendingBytesCompleted(t, fb) >= pendingBytesLength(t, fb)
 }
 
@@ -375,24 +569,43 @@ func pendingBytesCompleted(t *torrent.Torrent, fb *bitmap.Bitmap) int64 {
 
 //export TorrentFileDeleteUnselected
 func TorrentFileDeleteUnselected(i int) {
-	mu.Lock()
-	defer mu.Unlock()
+	defaultSession.TorrentFileDeleteUnselected(i)
+}
 
-	t := torrents[i]
+func (s *Session) TorrentFileDeleteUnselected(i int) {
+	s.setError(s.TorrentFileDeleteUnselectedE(i))
+}
 
-	err = torrentFileDeleteUnselected(t)
+func TorrentFileDeleteUnselectedE(i int) error {
+	return defaultSession.TorrentFileDeleteUnselectedE(i)
+}
+
+func (s *Session) TorrentFileDeleteUnselectedE(i int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
 	if err != nil {
-		return
+		return err
 	}
-	fileUpdateCheck(t)
+	if t.Info() == nil {
+		return ErrNoMetadata
+	}
+
+	err = s.torrentFileDeleteUnselected(t)
+	if err != nil {
+		return err
+	}
+	s.fileUpdateCheck(t)
+	return nil
 }
 
-func torrentFileDeleteUnselected(t *torrent.Torrent) error {
+func (s *Session) torrentFileDeleteUnselected(t *torrent.Torrent) error {
 	hash := t.InfoHash()
 
-	torrentstorageLock.Lock()
-	defer torrentstorageLock.Unlock()
-	ts := torrentstorage[hash]
+	s.torrentstorageLock.Lock()
+	defer s.torrentstorageLock.Unlock()
+	ts := s.torrentstorage[hash]
 
 	info := ts.info
 	checks := ts.checks
@@ -401,20 +614,16 @@ func torrentFileDeleteUnselected(t *torrent.Torrent) error {
 
 	var offset int64
 	for i, fi := range info.UpvertedFiles() {
-		s := offset / info.PieceLength
+		b := offset / info.PieceLength
 		e := (offset + fi.Length) / info.PieceLength
 		r := (offset + fi.Length) % info.PieceLength
 		if r > 0 {
 			e++
 		}
-		if !checks[i] && !bitmapIntersects(bm, int(s), int(e)) {
-			name := ts.root
-			if name == "" { // torrent havent been renamed
-				name = ts.info.Name
-			}
-			rel := filepath.Join(append([]string{name}, fi.Path...)...)
-			if storageExternal != nil {
-				err := storageExternal.Remove(hash.HexString(), rel)
+		if !checks[i] && !bitmapIntersects(bm, int(b), int(e)) {
+			rel := ts.fileRel(i, fi)
+			if s.storageExternal != nil {
+				err := s.storageExternal.Remove(hash.HexString(), rel)
 				if err != nil {
 					return err
 				}
@@ -425,8 +634,8 @@ func torrentFileDeleteUnselected(t *torrent.Torrent) error {
 					return err
 				}
 			}
-			ts.completedPieces.RemoveRange(int(s), int(e))
-			t.RemoveCompleted(int(s), int(e))
+			ts.completedPieces.RemoveRange(int(b), int(e))
+			t.RemoveCompleted(int(b), int(e))
 		}
 		offset += fi.Length
 	}
@@ -1,8 +1,16 @@
 package libtorrent
 
 import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
 )
 
 func TestWildcast(t *testing.T) {
@@ -49,3 +57,73 @@ func TestWildcast(t *testing.T) {
 		t.Error(s, m.MatchString(s))
 	}
 }
+
+func TestTorrentFileRename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libtorrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := NewConfig()
+	cfg.BindAddr = ":0"
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	info, err := bencode.Marshal(metainfo.Info{
+		Name:        "a",
+		PieceLength: 16 * 1024,
+		Pieces:      make([]byte, 20),
+		Files: []metainfo.FileInfo{
+			{Length: 1, Path: []string{"b"}},
+			{Length: 1, Path: []string{"c"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mi bytes.Buffer
+	err = (&metainfo.MetaInfo{InfoBytes: info}).Write(&mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := s.AddTorrentFromBytesE(dir, mi.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.TorrentFilesCount(i)
+
+	err = os.MkdirAll(filepath.Join(dir, "a"), 0770)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "a", "b"), []byte{1}, 0660)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.TorrentFileRenameE(i, 2, "d"); !errors.Is(err, ErrUnknownFile) {
+		t.Error(err)
+	}
+	if err = s.TorrentFileRenameE(i, 0, "../d"); !errors.Is(err, ErrBadFileName) {
+		t.Error(err)
+	}
+	if err = s.TorrentFileRenameE(i, 0, "c"); !errors.Is(err, ErrAlreadyExists) {
+		t.Error(err)
+	}
+
+	err = s.TorrentFileRenameE(i, 0, "e/f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "a", "e", "f")); err != nil {
+		t.Error(err)
+	}
+	s.TorrentFilesCount(i)
+	if f := s.TorrentFiles(i, 0); f.Path != "a/e/f" {
+		t.Error(f.Path)
+	}
+}
@@ -0,0 +1,167 @@
+package libtorrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/anacrolix/missinggo/bitmap"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// FileStat
+//
+// File size and modification time (nanoseconds). Saved with torrent state to
+// detect files changed while application closed. Size -1 - file missing.
+type FileStat struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mtime"`
+}
+
+// torrent files locations, collected under lock and stat'ed without it, so
+// slow disks / external storage do not block session
+type filePaths struct {
+	ext  FileStorageTorrent
+	hash string
+	path string
+	rels []string
+}
+
+// current torrent files locations, nil if no metadata. lock outside.
+func (s *Session) filePaths(t *torrent.Torrent) *filePaths {
+	s.torrentstorageLock.Lock()
+	defer s.torrentstorageLock.Unlock()
+	ts := s.torrentstorage[t.InfoHash()]
+	if ts.info == nil {
+		return nil
+	}
+	p := &filePaths{ext: s.storageExternal, hash: ts.infoHash.HexString(), path: ts.path}
+	for i, fi := range ts.info.UpvertedFiles() {
+		p.rels = append(p.rels, ts.fileRel(i, fi))
+	}
+	return p
+}
+
+// files locations from saved state, before torrent loaded. nil if state has
+// no metainfo or no saved stats.
+func (s *Session) stateFilePaths(path string, state *TorrentState) *filePaths {
+	if state.Files == nil || state.MetaInfo == nil {
+		return nil
+	}
+	info, err := state.MetaInfo.UnmarshalInfo()
+	if err != nil {
+		return nil
+	}
+	if path == "" {
+		path = state.Path
+	}
+	s.torrentstorageLock.Lock()
+	ext := s.storageExternal
+	s.torrentstorageLock.Unlock()
+	ts := &torrentStorage{info: &info, root: state.Root, files: state.Renames}
+	p := &filePaths{ext: ext, hash: state.MetaInfo.HashInfoBytes().HexString(), path: path}
+	for i, fi := range info.UpvertedFiles() {
+		p.rels = append(p.rels, ts.fileRel(i, fi))
+	}
+	return p
+}
+
+// files stats, nil if no metadata
+func (p *filePaths) stats() []FileStat {
+	if p == nil {
+		return nil
+	}
+	stats := make([]FileStat, len(p.rels))
+	for i, rel := range p.rels {
+		stats[i] = fileStat(p.ext, p.hash, p.path, rel)
+	}
+	return stats
+}
+
+// stat errors reported as missing file, so they never match saved state
+func fileStat(ext FileStorageTorrent, hash string, path string, rel string) FileStat {
+	missing := FileStat{Size: -1}
+	if ext != nil {
+		st, err := ext.Stat(hash, rel)
+		if err != nil || st == nil {
+			return missing
+		}
+		return *st
+	}
+	fi, err := os.Stat(filepath.Join(path, rel))
+	if err != nil {
+		return missing
+	}
+	return FileStat{fi.Size(), fi.ModTime().UnixNano()}
+}
+
+// pieces overlapping files which stats differ from saved ones
+func fileChangedPieces(info *metainfo.Info, saved []FileStat, stats []FileStat) (pieces bitmap.Bitmap) {
+	if len(saved) != len(stats) { // old state or metadata changed
+		return
+	}
+	for i := range stats {
+		if saved[i] == stats[i] {
+			continue
+		}
+		off, l := fileRange(info, i)
+		if l == 0 {
+			continue
+		}
+		pieces.AddRange(int(off/info.PieceLength), int((off+l-1)/info.PieceLength)+1)
+	}
+	return
+}
+
+// compare current files stats (see stateFilePaths()) against saved ones, clear
+// completed pieces of changed files and recheck them in background. lock
+// outside.
+func (s *Session) fileValidate(t *torrent.Torrent, saved []FileStat, stats []FileStat) {
+	if saved == nil {
+		return
+	}
+
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[t.InfoHash()]
+	info := ts.info
+	var recheck bitmap.Bitmap
+	changed := fileChangedPieces(info, saved, stats)
+	changed.IterTyped(func(piece int) (again bool) {
+		if ts.completedPieces.Contains(piece) {
+			ts.completedPieces.Remove(piece)
+			recheck.Add(piece)
+		}
+		return true
+	})
+	ts.Completed()
+	s.torrentstorageLock.Unlock()
+
+	if recheck.Len() == 0 {
+		return
+	}
+
+	go s.fileRecheck(t, ts, info, recheck)
+}
+
+// hash cleared pieces, mark complete these which still match. pieces
+// downloaded meanwhile stay as they are.
+func (s *Session) fileRecheck(t *torrent.Torrent, ts *torrentStorage, info *metainfo.Info, pieces bitmap.Bitmap) {
+	st := &fileTorrentStorage{ts}
+	pieces.IterTyped(func(i int) (again bool) {
+		p := info.Piece(i)
+		h := sha1.New()
+		_, err := io.Copy(h, io.NewSectionReader(st.Piece(p), 0, p.Length()))
+		if err != nil || !bytes.Equal(h.Sum(nil), p.Hash().Bytes()) {
+			return true
+		}
+		s.torrentstorageLock.Lock()
+		ts.completedPieces.Add(i)
+		ts.Completed()
+		s.torrentstorageLock.Unlock()
+		return true
+	})
+	t.UpdateAllPieceCompletions()
+}
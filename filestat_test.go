@@ -0,0 +1,67 @@
+package libtorrent
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestFileChangedPieces(t *testing.T) {
+	info := &metainfo.Info{
+		PieceLength: 10,
+		Files: []metainfo.FileInfo{
+			{Length: 15},
+			{Length: 0},
+			{Length: 10},
+		},
+	}
+	saved := []FileStat{{15, 1}, {0, 1}, {10, 1}}
+
+	if c := fileChangedPieces(info, saved, saved); c.Len() != 0 {
+		t.Error(c.Len())
+	}
+	if c := fileChangedPieces(info, saved, nil); c.Len() != 0 { // old state
+		t.Error(c.Len())
+	}
+	c := fileChangedPieces(info, saved, []FileStat{{15, 1}, {-1, 0}, {10, 2}})
+	if c.Len() != 2 || !c.Contains(1) || !c.Contains(2) {
+		t.Error(c.ToSortedSlice())
+	}
+}
+
+func TestStateFilePaths(t *testing.T) {
+	info, err := bencode.Marshal(metainfo.Info{
+		Name:        "a",
+		PieceLength: 16 * 1024,
+		Pieces:      make([]byte, 20),
+		Files: []metainfo.FileInfo{
+			{Length: 1, Path: []string{"b"}},
+			{Length: 1, Path: []string{"c"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := &TorrentState{
+		MetaInfo: &metainfo.MetaInfo{InfoBytes: info},
+		Path:     "/d",
+		Root:     "e",
+		Renames:  map[int]string{1: "f/g"},
+	}
+
+	s := newSession(NewConfig())
+	if p := s.stateFilePaths("", state); p != nil { // no saved stats
+		t.Error(p)
+	}
+	state.Files = []FileStat{{1, 1}, {1, 1}}
+	p := s.stateFilePaths("", state)
+	if p.path != "/d" || !reflect.DeepEqual(p.rels, []string{filepath.Join("e", "b"), filepath.Join("e", "f", "g")}) {
+		t.Error(p.path, p.rels)
+	}
+	if p = s.stateFilePaths("/h", state); p.path != "/h" {
+		t.Error(p.path)
+	}
+}
@@ -0,0 +1,230 @@
+package libtorrent
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// media types missing on some platforms (android has no /etc/mime.types)
+var httpMediaTypes = map[string]string{
+	".avi":  "video/x-msvideo",
+	".flac": "audio/flac",
+	".m4a":  "audio/mp4",
+	".m4v":  "video/mp4",
+	".mkv":  "video/x-matroska",
+	".mov":  "video/quicktime",
+	".mp3":  "audio/mpeg",
+	".mp4":  "video/mp4",
+	".ogg":  "audio/ogg",
+	".ts":   "video/mp2t",
+	".wav":  "audio/wav",
+	".webm": "video/webm",
+	".srt":  "application/x-subrip",
+}
+
+// StartHTTPServer
+//
+// Start embedded http server to stream torrent files while they are
+// downloading:
+//
+//	/torrent/{hash}/{file index} - file data, Range requests supported
+//	/torrent/{hash}/playlist.m3u - torrent audio / video files playlist
+//
+// Use ":0" address for random port, see HTTPServerAddr().
+//
+//export StartHTTPServer
+func StartHTTPServer(addr string) bool {
+	return defaultSession.StartHTTPServer(addr)
+}
+
+func (s *Session) StartHTTPServer(addr string) bool {
+	err := s.StartHTTPServerE(addr)
+	s.setError(err)
+	return err == nil
+}
+
+func StartHTTPServerE(addr string) error {
+	return defaultSession.StartHTTPServerE(addr)
+}
+
+func (s *Session) StartHTTPServerE(addr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.httpServer != nil {
+		return errors.New("http server already started")
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.httpServer = &http.Server{Handler: s.HTTPHandler()}
+	s.httpListener = l
+
+	go s.httpServer.Serve(l)
+
+	return nil
+}
+
+//export StopHTTPServer
+func StopHTTPServer() {
+	defaultSession.StopHTTPServer()
+}
+
+func (s *Session) StopHTTPServer() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.httpStop()
+}
+
+// HTTPServerAddr
+//
+// Embedded http server listening address, empty if not started.
+//
+//export HTTPServerAddr
+func HTTPServerAddr() string {
+	return defaultSession.HTTPServerAddr()
+}
+
+func (s *Session) HTTPServerAddr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.httpListener == nil {
+		return ""
+	}
+	return s.httpListener.Addr().String()
+}
+
+// HTTPHandler
+//
+// Streaming handler, same as StartHTTPServer() serves, to use with
+// application own http server.
+func HTTPHandler() http.Handler {
+	return defaultSession.HTTPHandler()
+}
+
+func (s *Session) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/torrent/", s.httpTorrent)
+	return mux
+}
+
+func (s *Session) httpStop() {
+	if s.httpServer != nil {
+		s.httpServer.Close()
+		s.httpServer = nil
+		s.httpListener = nil
+	}
+}
+
+func httpContentType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if t, ok := httpMediaTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+func httpMedia(name string) bool {
+	t := httpContentType(name)
+	return strings.HasPrefix(t, "video/") || strings.HasPrefix(t, "audio/")
+}
+
+func (s *Session) torrentByHash(hash string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash = strings.ToLower(hash)
+	for i, t := range s.torrents {
+		if t.InfoHash().HexString() == hash {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// torrent files paths, renames applied
+func (s *Session) httpFiles(i int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return nil, err
+	}
+	if t.Info() == nil {
+		return nil, ErrNoMetadata
+	}
+	var ff []string
+	for _, f := range s.torrentFiles(t) {
+		ff = append(ff, f.Path)
+	}
+	return ff, nil
+}
+
+// /torrent/{hash}/{file index} or /torrent/{hash}/playlist.m3u
+func (s *Session) httpTorrent(w http.ResponseWriter, r *http.Request) {
+	pp := strings.Split(strings.TrimPrefix(r.URL.Path, "/torrent/"), "/")
+	if len(pp) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	i, ok := s.torrentByHash(pp[0])
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	files, err := s.httpFiles(i)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if pp[1] == "playlist.m3u" {
+		s.httpPlaylist(w, r, pp[0], files)
+		return
+	}
+
+	p, err := strconv.Atoi(pp[1])
+	if err != nil || p < 0 || p >= len(files) {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := s.TorrentFileReader(i, p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	go func() { // client gone, unblock waiting Read()
+		<-r.Context().Done()
+		f.Close()
+	}()
+
+	w.Header().Set("Content-Type", httpContentType(files[p]))
+	http.ServeContent(w, r, path.Base(files[p]), time.Time{}, f)
+}
+
+func (s *Session) httpPlaylist(w http.ResponseWriter, r *http.Request, hash string, files []string) {
+	w.Header().Set("Content-Type", "audio/x-mpegurl")
+	fmt.Fprintln(w, "#EXTM3U")
+	for p, f := range files {
+		if !httpMedia(f) {
+			continue
+		}
+		fmt.Fprintf(w, "#EXTINF:-1,%s\n", path.Base(f))
+		fmt.Fprintf(w, "http://%s/torrent/%s/%d\n", r.Host, hash, p)
+	}
+}
@@ -0,0 +1,28 @@
+package libtorrent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPContentType(t *testing.T) {
+	if c := httpContentType("a/Movie.MKV"); c != "video/x-matroska" {
+		t.Error(c)
+	}
+	if c := httpContentType("a/b"); c != "application/octet-stream" {
+		t.Error(c)
+	}
+	if !httpMedia("a.mp3") || httpMedia("a.txt") {
+		t.Error("media")
+	}
+}
+
+func TestHTTPNotFound(t *testing.T) {
+	s := &Session{}
+	w := httptest.NewRecorder()
+	s.HTTPHandler().ServeHTTP(w, httptest.NewRequest("GET", "/torrent/0123/0", nil))
+	if w.Code != http.StatusNotFound {
+		t.Error(w.Code)
+	}
+}
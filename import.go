@@ -0,0 +1,431 @@
+package libtorrent
+
+import (
+	"bytes"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// transmission and rasterbar block size, used by progress bitfields
+const resumeBlockSize = 16 * 1024
+
+// libtorrent-rasterbar .fastresume, qBittorrent adds qBt-* keys
+type fastResume struct {
+	InfoHash string        `bencode:"info-hash"`
+	Info     bencode.Bytes `bencode:"info,omitempty"` // rasterbar 2.x keeps metadata inside resume data
+	Name     string        `bencode:"name"`
+	SavePath string        `bencode:"save_path"`
+
+	Pieces        string     `bencode:"pieces"` // byte per piece, bit 0 - have
+	FilePriority  []int64    `bencode:"file_priority"`
+	MappedFiles   []string   `bencode:"mapped_files"`
+	Trackers      [][]string `bencode:"trackers"`
+	UrlList       []string   `bencode:"url-list"`
+	Sequential    int64      `bencode:"sequential_download"`
+	UploadLimit   int64      `bencode:"upload_rate_limit"`
+	DownloadLimit int64      `bencode:"download_rate_limit"`
+
+	TotalUploaded   int64 `bencode:"total_uploaded"`
+	TotalDownloaded int64 `bencode:"total_downloaded"`
+	ActiveTime      int64 `bencode:"active_time"`   // seconds
+	FinishedTime    int64 `bencode:"finished_time"` // seconds
+	SeedingTime     int64 `bencode:"seeding_time"`  // seconds
+	AddedTime       int64 `bencode:"added_time"`    // unix time
+	CompletedTime   int64 `bencode:"completed_time"`
+
+	QBtSavePath         string `bencode:"qBt-savePath"`
+	QBtRatioLimit       *int64 `bencode:"qBt-ratioLimit"`       // ratio * 1000, -2 - global, -1 - unlimited
+	QBtSeedingTimeLimit *int64 `bencode:"qBt-seedingTimeLimit"` // minutes, -2 - global, -1 - unlimited
+}
+
+// Transmission .resume
+type transmissionResume struct {
+	Destination string   `bencode:"destination"`
+	Name        string   `bencode:"name"`  // renamed torrent
+	Files       []string `bencode:"files"` // renamed files, torrent name included
+	Dnd         []int64  `bencode:"dnd"`
+	Priority    []int64  `bencode:"priority"` // -1 low, 0 normal, 1 high
+	Progress    struct {
+		Have     string `bencode:"have"`     // "all" when done
+		Pieces   string `bencode:"pieces"`   // "all", "none" or bitfield
+		Blocks   string `bencode:"blocks"`   // "all", "none" or bitfield
+		Bitfield string `bencode:"bitfield"` // old versions blocks
+	} `bencode:"progress"`
+	Sequential int64 `bencode:"sequentialDownload"`
+
+	Downloaded      int64 `bencode:"downloaded"`
+	Uploaded        int64 `bencode:"uploaded"`
+	AddedDate       int64 `bencode:"added-date"` // unix time
+	DoneDate        int64 `bencode:"done-date"`
+	DownloadingTime int64 `bencode:"downloading-time-seconds"`
+	SeedingTime     int64 `bencode:"seeding-time-seconds"`
+
+	SpeedLimitUp   transmissionSpeed `bencode:"speed-limit-up"`
+	SpeedLimitDown transmissionSpeed `bencode:"speed-limit-down"`
+	RatioLimit     struct {
+		RatioLimit string `bencode:"ratio-limit"`
+		RatioMode  int64  `bencode:"ratio-mode"` // 0 - global, 1 - single, 2 - unlimited
+	} `bencode:"ratio-limit"`
+}
+
+type transmissionSpeed struct {
+	Bps int64 `bencode:"speed-Bps"`
+	Use int64 `bencode:"use-speed-limit"`
+}
+
+// ImportFastResume
+//
+// Add torrent from libtorrent-rasterbar / qBittorrent .fastresume file keeping
+// completed pieces, file priorities, renames, stats and dates. 'torrent' is
+// .torrent file, can be nil when resume data has metadata inside. Empty path
+// means save path from resume data.
+//
+//export ImportFastResume
+func ImportFastResume(path string, torrent []byte, resume []byte) int {
+	return defaultSession.ImportFastResume(path, torrent, resume)
+}
+
+func (s *Session) ImportFastResume(path string, torrent []byte, resume []byte) int {
+	i, err := s.ImportFastResumeE(path, torrent, resume)
+	s.setError(err)
+	return i
+}
+
+func ImportFastResumeE(path string, torrent []byte, resume []byte) (int, error) {
+	return defaultSession.ImportFastResumeE(path, torrent, resume)
+}
+
+func (s *Session) ImportFastResumeE(path string, torrent []byte, resume []byte) (int, error) {
+	var r fastResume
+	err := bencode.Unmarshal(resume, &r)
+	if err != nil {
+		return -1, err
+	}
+	state, err := fastResumeState(&r, torrent)
+	if err != nil {
+		return -1, err
+	}
+	return s.importState(path, state)
+}
+
+// ImportTransmissionResume
+//
+// Add torrent from Transmission .resume file keeping completed pieces, file
+// priorities, renames, stats and dates. 'torrent' is .torrent file from
+// Transmission torrents folder. Empty path means resume data destination.
+//
+//export ImportTransmissionResume
+func ImportTransmissionResume(path string, torrent []byte, resume []byte) int {
+	return defaultSession.ImportTransmissionResume(path, torrent, resume)
+}
+
+func (s *Session) ImportTransmissionResume(path string, torrent []byte, resume []byte) int {
+	i, err := s.ImportTransmissionResumeE(path, torrent, resume)
+	s.setError(err)
+	return i
+}
+
+func ImportTransmissionResumeE(path string, torrent []byte, resume []byte) (int, error) {
+	return defaultSession.ImportTransmissionResumeE(path, torrent, resume)
+}
+
+func (s *Session) ImportTransmissionResumeE(path string, torrent []byte, resume []byte) (int, error) {
+	var r transmissionResume
+	err := bencode.Unmarshal(resume, &r)
+	if err != nil {
+		return -1, err
+	}
+	state, err := transmissionResumeState(&r, torrent)
+	if err != nil {
+		return -1, err
+	}
+	return s.importState(path, state)
+}
+
+func (s *Session) importState(path string, state *TorrentState) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.loadState(path, state, nil)
+	if err != nil {
+		return -1, err
+	}
+
+	return s.register(t), nil
+}
+
+func fastResumeState(r *fastResume, torrent []byte) (*TorrentState, error) {
+	state := &TorrentState{Version: stateVersion}
+
+	var mi *metainfo.MetaInfo
+	if torrent != nil {
+		m, err := metainfo.Load(bytes.NewReader(torrent))
+		if err != nil {
+			return nil, err
+		}
+		mi = m
+	} else if r.Info != nil {
+		mi = &metainfo.MetaInfo{InfoBytes: r.Info}
+	}
+
+	if mi != nil {
+		if len(r.InfoHash) == 20 && mi.HashInfoBytes() != resumeHash(r.InfoHash) {
+			return nil, ErrBadResume
+		}
+		if len(r.Trackers) > 0 {
+			mi.AnnounceList = r.Trackers
+		}
+		info, err := mi.UnmarshalInfo()
+		if err != nil {
+			return nil, err
+		}
+		state.MetaInfo = mi
+
+		state.Pieces = make([]bool, info.NumPieces())
+		for i := 0; i < len(r.Pieces) && i < len(state.Pieces); i++ {
+			state.Pieces[i] = r.Pieces[i]&1 != 0
+		}
+
+		qbt := r.QBtRatioLimit != nil || r.QBtSeedingTimeLimit != nil || r.QBtSavePath != ""
+		if r.FilePriority != nil {
+			state.Priorities = make([]int32, len(info.UpvertedFiles()))
+			for i := range state.Priorities {
+				state.Priorities[i] = FilePriorityNormal
+				if i < len(r.FilePriority) {
+					state.Priorities[i] = fastResumePriority(r.FilePriority[i], qbt)
+				}
+			}
+		}
+
+		resumeRenames(&info, r.MappedFiles, state)
+	} else {
+		if len(r.InfoHash) != 20 {
+			return nil, ErrBadResume
+		}
+		hash := resumeHash(r.InfoHash)
+		state.InfoHash = &hash
+		state.Name = r.Name
+		state.Trackers = r.Trackers
+	}
+
+	state.Path = r.SavePath
+	if r.QBtSavePath != "" {
+		state.Path = r.QBtSavePath
+	}
+
+	state.Downloaded = r.TotalDownloaded
+	state.Uploaded = r.TotalUploaded
+	state.AddedDate = resumeDate(r.AddedTime)
+	state.CompletedDate = resumeDate(r.CompletedTime)
+	state.SeedingTime = (time.Duration(r.SeedingTime) * time.Second).Nanoseconds()
+	if r.ActiveTime > r.FinishedTime {
+		state.DownloadingTime = (time.Duration(r.ActiveTime-r.FinishedTime) * time.Second).Nanoseconds()
+	}
+
+	state.UrlList = r.UrlList
+	state.Sequential = r.Sequential != 0
+	if r.UploadLimit > 0 {
+		state.UploadRate = int(r.UploadLimit)
+	}
+	if r.DownloadLimit > 0 {
+		state.DownloadRate = int(r.DownloadLimit)
+	}
+
+	if r.QBtRatioLimit != nil {
+		switch v := *r.QBtRatioLimit; {
+		case v == -1:
+			state.SeedRatio = -1
+		case v >= 0:
+			state.SeedRatio = float64(v) / 1000
+		}
+	}
+	if r.QBtSeedingTimeLimit != nil {
+		switch v := *r.QBtSeedingTimeLimit; {
+		case v == -1:
+			state.SeedTime = -1
+		case v >= 0:
+			state.SeedTime = (time.Duration(v) * time.Minute).Nanoseconds()
+		}
+	}
+
+	return state, nil
+}
+
+func transmissionResumeState(r *transmissionResume, torrent []byte) (*TorrentState, error) {
+	if torrent == nil {
+		return nil, ErrNoMetadata
+	}
+	mi, err := metainfo.Load(bytes.NewReader(torrent))
+	if err != nil {
+		return nil, err
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &TorrentState{Version: stateVersion, MetaInfo: mi, Path: r.Destination}
+
+	n := info.NumPieces()
+	p := r.Progress
+	switch {
+	case p.Have == "all" || p.Pieces == "all" || p.Blocks == "all" || p.Bitfield == "all":
+		state.Pieces = make([]bool, n)
+		for i := range state.Pieces {
+			state.Pieces[i] = true
+		}
+	case p.Pieces != "" && p.Pieces != "none":
+		state.Pieces = bitfieldPieces([]byte(p.Pieces), n)
+	case p.Blocks != "" && p.Blocks != "none":
+		state.Pieces = blocksPieces(&info, []byte(p.Blocks))
+	case p.Bitfield != "" && p.Bitfield != "none":
+		state.Pieces = blocksPieces(&info, []byte(p.Bitfield))
+	}
+
+	files := info.UpvertedFiles()
+	if r.Dnd != nil || r.Priority != nil {
+		state.Priorities = make([]int32, len(files))
+		for i := range state.Priorities {
+			state.Priorities[i] = FilePriorityNormal
+			if i < len(r.Priority) {
+				switch {
+				case r.Priority[i] < 0:
+					state.Priorities[i] = FilePriorityLow
+				case r.Priority[i] > 0:
+					state.Priorities[i] = FilePriorityHigh
+				}
+			}
+			if i < len(r.Dnd) && r.Dnd[i] != 0 {
+				state.Priorities[i] = FilePrioritySkip
+			}
+		}
+	}
+
+	resumeRenames(&info, r.Files, state)
+	if r.Name != "" && r.Name != info.Name {
+		state.Root = r.Name
+	}
+
+	state.Downloaded = r.Downloaded
+	state.Uploaded = r.Uploaded
+	state.AddedDate = resumeDate(r.AddedDate)
+	state.CompletedDate = resumeDate(r.DoneDate)
+	state.DownloadingTime = (time.Duration(r.DownloadingTime) * time.Second).Nanoseconds()
+	state.SeedingTime = (time.Duration(r.SeedingTime) * time.Second).Nanoseconds()
+
+	state.Sequential = r.Sequential != 0
+	if r.SpeedLimitUp.Use != 0 && r.SpeedLimitUp.Bps > 0 {
+		state.UploadRate = int(r.SpeedLimitUp.Bps)
+	}
+	if r.SpeedLimitDown.Use != 0 && r.SpeedLimitDown.Bps > 0 {
+		state.DownloadRate = int(r.SpeedLimitDown.Bps)
+	}
+
+	switch r.RatioLimit.RatioMode {
+	case 1:
+		if v, err := strconv.ParseFloat(r.RatioLimit.RatioLimit, 64); err == nil && v > 0 {
+			state.SeedRatio = v
+		}
+	case 2:
+		state.SeedRatio = -1
+	}
+
+	return state, nil
+}
+
+// rasterbar priority 0..7 (4 - default), qBittorrent uses 1 as normal
+func fastResumePriority(p int64, qbt bool) int32 {
+	switch {
+	case p <= 0:
+		return FilePrioritySkip
+	case p == 7:
+		return FilePriorityMaximum
+	case p >= 5 && !qbt, p == 6:
+		return FilePriorityHigh
+	case p < 4 && !qbt:
+		return FilePriorityLow
+	default:
+		return FilePriorityNormal
+	}
+}
+
+// raw 20 bytes info hash
+func resumeHash(s string) (h metainfo.Hash) {
+	copy(h[:], s)
+	return
+}
+
+// unix time to nanoseconds, 0 - not set
+func resumeDate(t int64) int64 {
+	if t <= 0 {
+		return 0
+	}
+	return time.Unix(t, 0).UnixNano()
+}
+
+// bitfield, high bit first
+func bitfieldPieces(b []byte, n int) []bool {
+	pieces := make([]bool, n)
+	for i := 0; i < n && i/8 < len(b); i++ {
+		pieces[i] = b[i/8]&(0x80>>uint(i%8)) != 0
+	}
+	return pieces
+}
+
+// piece completed when all its blocks set
+func blocksPieces(info *metainfo.Info, b []byte) []bool {
+	n := info.NumPieces()
+	total := int((info.TotalLength() + resumeBlockSize - 1) / resumeBlockSize)
+	blocks := bitfieldPieces(b, total)
+	per := int(info.PieceLength / resumeBlockSize)
+	if per == 0 {
+		per = 1
+	}
+	pieces := make([]bool, n)
+	for i := range pieces {
+		pieces[i] = true
+		for k := i * per; k < (i+1)*per && k < total; k++ {
+			if !blocks[k] {
+				pieces[i] = false
+				break
+			}
+		}
+	}
+	return pieces
+}
+
+// fill Root and Renames from per file paths relative to save path, torrent
+// name included. empty path - file not renamed.
+func resumeRenames(info *metainfo.Info, paths []string, state *TorrentState) {
+	files := info.UpvertedFiles()
+	for i, p := range paths {
+		if p == "" || i >= len(files) {
+			continue
+		}
+		p = path.Clean(strings.Replace(p, "\\", "/", -1))
+		if len(info.Files) == 0 { // single file torrent, file name is torrent name
+			if p != info.Name {
+				state.Root = p
+			}
+			continue
+		}
+		ss := strings.SplitN(p, "/", 2)
+		if len(ss) != 2 {
+			continue
+		}
+		if ss[0] != info.Name {
+			state.Root = ss[0]
+		}
+		if ss[1] != strings.Join(files[i].Path, "/") {
+			if state.Renames == nil {
+				state.Renames = make(map[int]string)
+			}
+			state.Renames[i] = ss[1]
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package libtorrent
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// two files torrent, 3 pieces 32KB
+func importTorrent(t *testing.T) ([]byte, metainfo.Hash) {
+	info := metainfo.Info{
+		Name:        "a",
+		PieceLength: 32 * 1024,
+		Pieces:      make([]byte, 3*20),
+		Files: []metainfo.FileInfo{
+			{Length: 40 * 1024, Path: []string{"b", "c.txt"}},
+			{Length: 40 * 1024, Path: []string{"d.txt"}},
+		},
+	}
+	ib, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi := metainfo.MetaInfo{InfoBytes: ib}
+	buf, err := bencode.Marshal(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf, mi.HashInfoBytes()
+}
+
+func TestFastResumeState(t *testing.T) {
+	torrent, hash := importTorrent(t)
+	r := &fastResume{
+		InfoHash:      string(hash.Bytes()),
+		SavePath:      "/data",
+		Pieces:        "\x01\x00\x03",
+		FilePriority:  []int64{0, 7},
+		MappedFiles:   []string{"", "a2/e.txt"},
+		AddedTime:     100,
+		ActiveTime:    30,
+		FinishedTime:  10,
+		TotalUploaded: 5,
+	}
+	state, err := fastResumeState(r, torrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state.Pieces, []bool{true, false, true}) {
+		t.Error(state.Pieces)
+	}
+	if !reflect.DeepEqual(state.Priorities, []int32{FilePrioritySkip, FilePriorityMaximum}) {
+		t.Error(state.Priorities)
+	}
+	if state.Root != "a2" || state.Renames[1] != "e.txt" || len(state.Renames) != 1 {
+		t.Error(state.Root, state.Renames)
+	}
+	if state.Path != "/data" || state.Uploaded != 5 || state.AddedDate != 100*1e9 || state.DownloadingTime != 20*1e9 {
+		t.Error(state.Path, state.Uploaded, state.AddedDate, state.DownloadingTime)
+	}
+
+	r.InfoHash = "01234567890123456789"
+	if _, err := fastResumeState(r, torrent); err != ErrBadResume {
+		t.Error(err)
+	}
+}
+
+func TestFastResumePriority(t *testing.T) {
+	if fastResumePriority(1, false) != FilePriorityLow || fastResumePriority(1, true) != FilePriorityNormal {
+		t.Error("low")
+	}
+	if fastResumePriority(4, false) != FilePriorityNormal || fastResumePriority(6, true) != FilePriorityHigh {
+		t.Error("high")
+	}
+}
+
+func TestTransmissionResumeState(t *testing.T) {
+	torrent, _ := importTorrent(t)
+	r := &transmissionResume{
+		Destination: "/data",
+		Dnd:         []int64{0, 1},
+		Priority:    []int64{1, 0},
+	}
+	r.Progress.Blocks = "\xd8" // blocks 0, 1, 3, 4: pieces 0 and 2 (short, single block)
+	state, err := transmissionResumeState(r, torrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state.Pieces, []bool{true, false, true}) {
+		t.Error(state.Pieces)
+	}
+	if !reflect.DeepEqual(state.Priorities, []int32{FilePriorityHigh, FilePrioritySkip}) {
+		t.Error(state.Priorities)
+	}
+
+	r.Progress.Blocks = ""
+	r.Progress.Have = "all"
+	state, _ = transmissionResumeState(r, torrent)
+	if !reflect.DeepEqual(state.Pieces, []bool{true, true, true}) {
+		t.Error(state.Pieces)
+	}
+
+	if _, err := transmissionResumeState(r, nil); err != ErrNoMetadata {
+		t.Error(err)
+	}
+}
+
+func TestBitfieldPieces(t *testing.T) {
+	if !reflect.DeepEqual(bitfieldPieces([]byte{0xa0}, 4), []bool{true, false, true, false}) {
+		t.Error("bitfield")
+	}
+	if !reflect.DeepEqual(bitfieldPieces(nil, 2), []bool{false, false}) {
+		t.Error("short")
+	}
+}
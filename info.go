@@ -11,56 +11,112 @@ import (
 //
 //export TorrentMagnet
 func TorrentMagnet(i int) string {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
+	return defaultSession.TorrentMagnet(i)
+}
+
+func (s *Session) TorrentMagnet(i int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return ""
+	}
 	mi := t.Metainfo()
-	name := torrentName(t)
+	name := s.torrentName(t)
 	return mi.Magnet(name, t.InfoHash()).String()
 }
 
 func TorrentMetainfo(i int) *metainfo.MetaInfo {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
+	return defaultSession.TorrentMetainfo(i)
+}
+
+func (s *Session) TorrentMetainfo(i int) *metainfo.MetaInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return nil
+	}
 	mi := t.Metainfo()
 	return &mi
 }
 
 //export TorrentHash
 func TorrentHash(i int) string {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
+	return defaultSession.TorrentHash(i)
+}
+
+func (s *Session) TorrentHash(i int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return ""
+	}
 	h := t.InfoHash()
 	return h.HexString()
 }
 
 //export TorrentName
 func TorrentName(i int) string {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
-	return torrentName(t)
+	return defaultSession.TorrentName(i)
 }
 
-func torrentName(t *torrent.Torrent) string {
-	torrentstorageLock.Lock()
-	ts := torrentstorage[t.InfoHash()]
+func (s *Session) TorrentName(i int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return ""
+	}
+	return s.torrentName(t)
+}
+
+func (s *Session) torrentName(t *torrent.Torrent) string {
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[t.InfoHash()]
 	root := ts.root
-	torrentstorageLock.Unlock()
+	s.torrentstorageLock.Unlock()
 	if root != "" {
 		return root
 	}
 	return t.Name()
 }
 
+// TorrentPath
+//
+// Torrent download folder, torrent name (root) not included.
+//
+//export TorrentPath
+func TorrentPath(i int) string {
+	return defaultSession.TorrentPath(i)
+}
+
+func (s *Session) TorrentPath(i int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return ""
+	}
+	s.torrentstorageLock.Lock()
+	defer s.torrentstorageLock.Unlock()
+	return s.torrentstorage[t.InfoHash()].path
+}
+
 //export TorrentActive
 func TorrentActive(i int) bool {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
-	if _, ok := active[t]; ok {
+	return defaultSession.TorrentActive(i)
+}
+
+func (s *Session) TorrentActive(i int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return false
+	}
+	if _, ok := s.active[t]; ok {
 		return true
 	} else {
 		return false
@@ -73,19 +129,30 @@ const (
 	StatusSeeding     int32 = 2
 	StatusChecking    int32 = 3
 	StatusQueued      int32 = 4
+	StatusForced      int32 = 5 // force started, downloading or seeding out of queue
 )
 
 //export TorrentStatus
 func TorrentStatus(i int) int32 {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
-	return torrentStatus(t)
+	return defaultSession.TorrentStatus(i)
+}
+
+func (s *Session) TorrentStatus(i int) int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
+	return s.torrentStatus(t)
 }
 
-func torrentStatus(t *torrent.Torrent) int32 {
-	if _, ok := active[t]; ok {
-		if pendingCompleted(t) {
+func (s *Session) torrentStatus(t *torrent.Torrent) int32 {
+	if _, ok := s.active[t]; ok {
+		if s.forced[t] {
+			return StatusForced
+		}
+		if s.pendingCompleted(t) {
 			return StatusSeeding
 		}
 		return StatusDownloading
@@ -93,11 +160,11 @@ func torrentStatus(t *torrent.Torrent) int32 {
 		if t.Check() {
 			return StatusChecking
 		}
-		if _, ok := queue[t]; ok {
+		if _, ok := s.queue[t]; ok {
 			return StatusQueued
 		}
-		if pause != nil {
-			if _, ok := pause[t]; ok {
+		if s.pause != nil {
+			if _, ok := s.pause[t]; ok {
 				return StatusQueued
 			}
 		}
@@ -107,35 +174,63 @@ func torrentStatus(t *torrent.Torrent) int32 {
 
 //export TorrentBytesLength
 func TorrentBytesLength(i int) int64 {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
+	return defaultSession.TorrentBytesLength(i)
+}
+
+func (s *Session) TorrentBytesLength(i int) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
 	return t.Length()
 }
 
 //export TorrentBytesCompleted
 func TorrentBytesCompleted(i int) int64 {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
+	return defaultSession.TorrentBytesCompleted(i)
+}
+
+func (s *Session) TorrentBytesCompleted(i int) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
 	return t.BytesCompleted()
 }
 
 // Get total bytes for pending pieces list
 func TorrentPendingBytesLength(i int) int64 {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
-	fb := filePendingBitmap(t.InfoHash())
+	return defaultSession.TorrentPendingBytesLength(i)
+}
+
+func (s *Session) TorrentPendingBytesLength(i int) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
+	fb := s.filePendingBitmap(t.InfoHash())
 	return pendingBytesLength(t, fb)
 }
 
 // Get total bytes downloaded by pending pieces list
 func TorrentPendingBytesCompleted(i int) int64 {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
-	fb := filePendingBitmap(t.InfoHash())
+	return defaultSession.TorrentPendingBytesCompleted(i)
+}
+
+func (s *Session) TorrentPendingBytesCompleted(i int) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
+	fb := s.filePendingBitmap(t.InfoHash())
 	return pendingBytesCompleted(t, fb)
 }
 
@@ -147,19 +242,26 @@ type StatsTorrent struct {
 }
 
 func TorrentStats(i int) *StatsTorrent {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.TorrentStats(i)
+}
 
-	t := torrents[i]
-	fs := filestorage[t.InfoHash()]
+func (s *Session) TorrentStats(i int) *StatsTorrent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return nil
+	}
+	fs := s.filestorage[t.InfoHash()]
 
 	stats := t.Stats()
 	downloading := fs.DownloadingTime
 	seeding := fs.SeedingTime
 
-	if _, ok := active[t]; ok {
+	if _, ok := s.active[t]; ok {
 		now := time.Now().UnixNano()
-		if pendingCompleted(t) { // seeding
+		if s.pendingCompleted(t) { // seeding
 			seeding = seeding + (now - fs.ActivateDate)
 		} else {
 			downloading = downloading + (now - fs.ActivateDate)
@@ -178,32 +280,60 @@ type InfoTorrent struct {
 }
 
 func TorrentInfo(i int) *InfoTorrent {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
-	fs := filestorage[t.InfoHash()]
+	return defaultSession.TorrentInfo(i)
+}
+
+func (s *Session) TorrentInfo(i int) *InfoTorrent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return nil
+	}
+	fs := s.filestorage[t.InfoHash()]
 	return &InfoTorrent{fs.Creator, fs.CreatedOn, fs.Comment, fs.AddedDate, fs.CompletedDate}
 }
 
-func TorrentInfoName(i int, s string) {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
-	t.SetDisplayName(s)
+func TorrentInfoName(i int, v string) {
+	defaultSession.TorrentInfoName(i, v)
+}
+
+func (s *Session) TorrentInfoName(i int, v string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+	t.SetDisplayName(v)
 }
 
-func TorrentInfoCreator(i int, s string) {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
-	fs := filestorage[t.InfoHash()]
-	fs.Creator = s
+func TorrentInfoCreator(i int, v string) {
+	defaultSession.TorrentInfoCreator(i, v)
 }
 
-func TorrentInfoComment(i int, s string) {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
-	fs := filestorage[t.InfoHash()]
-	fs.Comment = s
+func (s *Session) TorrentInfoCreator(i int, v string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+	fs := s.filestorage[t.InfoHash()]
+	fs.Creator = v
+}
+
+func TorrentInfoComment(i int, v string) {
+	defaultSession.TorrentInfoComment(i, v)
+}
+
+func (s *Session) TorrentInfoComment(i int, v string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+	fs := s.filestorage[t.InfoHash()]
+	fs.Comment = v
 }
@@ -4,18 +4,6 @@ package libtorrent
 import "C"
 
 import (
-	"bufio"
-	"bytes"
-	"errors"
-	"fmt"
-	"net/http"
-	"path"
-	"strings"
-	"sync"
-	"time"
-
-	"github.com/anacrolix/torrent"
-	"github.com/anacrolix/torrent/metainfo"
 	"golang.org/x/time/rate"
 )
 
@@ -27,13 +15,7 @@ var (
 )
 
 func SetDefaultAnnouncesList(str string) {
-	mu.Lock()
-	defer mu.Unlock()
-
-	builtinAnnounceList = nil
-	for _, s := range strings.Split(str, "\n") {
-		builtinAnnounceList = append(builtinAnnounceList, []string{s})
-	}
+	defaultSession.SetDefaultAnnouncesList(str)
 }
 
 func limit(i int) *rate.Limiter {
@@ -49,43 +31,20 @@ func limit(i int) *rate.Limiter {
 }
 
 func SetUploadRate(i int) {
-	client.Config(func() { clientConfig.UploadRateLimiter = limit(i) })
+	defaultSession.SetUploadRate(i)
 }
 
 func SetDownloadRate(i int) {
-	client.Config(func() { clientConfig.DownloadRateLimiter = limit(i) })
+	defaultSession.SetDownloadRate(i)
 }
 
 //export CreateTorrentFileFromMetaInfo
 func CreateTorrentFileFromMetaInfo() []byte {
-	mu.Lock()
-	defer mu.Unlock()
-
-	return createTorrentFileFromMetaInfo()
-}
-
-func createTorrentFileFromMetaInfo() []byte {
-	var b bytes.Buffer
-	w := bufio.NewWriter(&b)
-	err = metainfoBuild.metainfo.Write(w)
-	if err != nil {
-		return nil
-	}
-	err = w.Flush()
-	if err != nil {
-		return nil
-	}
-	return b.Bytes()
+	return defaultSession.CreateTorrentFileFromMetaInfo()
 }
 
 func CreateTorrentFile(root string) []byte {
-	s := CreateMetainfoBuilder(&defaultMetainfoBuilder{root: root})
-	for i := 0; i < s; i++ {
-		HashMetaInfo(i)
-	}
-	buf := createTorrentFileFromMetaInfo()
-	CloseMetaInfo()
-	return buf
+	return defaultSession.CreateTorrentFile(root)
 }
 
 // Create
@@ -94,117 +53,43 @@ func CreateTorrentFile(root string) []byte {
 //
 //export Create
 func Create() bool {
-	mu.Lock()
-	defer mu.Unlock()
-
-	torrents = make(map[int]*torrent.Torrent)
-	filestorage = make(map[metainfo.Hash]*fileStorage)
-	torrentstorage = make(map[metainfo.Hash]*torrentStorage)
-	queue = make(map[*torrent.Torrent]int64)
-	active = make(map[*torrent.Torrent]int64)
-	webseedstorage = make(map[metainfo.Hash]*webSeeds)
-	pause = nil
-	index = 0
-	tcpPort = ""
-	udpPort = ""
-	mappingAddr = nil
-
-	clientConfig = torrent.NewDefaultClientConfig()
-	clientConfig.DefaultStorage = &torrentOpener{}
-	clientConfig.Seed = true
-	clientConfig.NoUpload = false
-	clientConfig.DisableAggressiveUpload = true
-	clientConfig.SetListenAddr(BindAddr)
-	clientConfig.UploadRateLimiter = rate.NewLimiter(rate.Inf, 0)
-	clientConfig.DownloadRateLimiter = rate.NewLimiter(rate.Inf, 0)
-	if Version != "" {
-		clientConfig.ExtendedHandshakeClientVersion = Version
-	}
-	clientConfig.HalfOpenConnsPerTorrent = SocketsPerTorrent
-	clientConfig.TorrentPeersLowWater = 2 * clientConfig.HalfOpenConnsPerTorrent
-	clientConfig.EstablishedConnsPerTorrent = clientConfig.TorrentPeersLowWater
-	if Bep20 != "" {
-		clientConfig.Bep20 = Bep20
-	}
-
-	client, err = torrent.NewClient(clientConfig)
-	if err != nil {
-		return false
-	}
-
-	lpdStart()
-
-	// when create client do 1 second discovery
-	mu.Unlock()
-	mappingPort(1 * time.Second)
-	mu.Lock()
-
-	err = client.Start()
-	if err != nil {
-		return false
-	}
-	clientAddr = ListenAddr()
-
-	go func() {
-		mappingStart()
-	}()
+	defaultSession.mu.Lock()
+	defaultSession.cfg = NewConfig()
+	defaultSession.mu.Unlock()
 
-	return true
-}
-
-type BytesInfo struct {
-	Downloaded int64
-	Uploaded   int64
+	return defaultSession.create()
 }
 
 func Stats() *BytesInfo {
-	stats := client.Stats()
-	return &BytesInfo{stats.BytesRead.Int64(), stats.BytesWritten.Int64()}
+	return defaultSession.Stats()
 }
 
 // Get Torrent Count
 //
 //export Count
 func Count() int {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.Count()
+}
 
-	return len(torrents)
+// Torrents
+//
+// Torrent indexes, sorted. Indexes are not continuous after RemoveTorrent().
+func Torrents() []int {
+	return defaultSession.Torrents()
 }
 
 //export ListenAddr
 func ListenAddr() string {
-	return fmt.Sprintf(":%d", client.LocalPort())
+	return defaultSession.ListenAddr()
 }
 
 //export CreateTorrentFromMetaInfo
 func CreateTorrentFromMetaInfo() int {
-	mu.Lock()
-	defer mu.Unlock()
-
-	var t *torrent.Torrent
-
-	hash := metainfoBuild.metainfo.HashInfoBytes()
-
-	if _, ok := filestorage[hash]; ok {
-		err = errors.New("Already exists")
-		return -1
-	}
-
-	fs := registerFileStorage(hash, metainfoBuild.b.Root())
-
-	fs.Comment = metainfoBuild.metainfo.Comment
-	fs.Creator = metainfoBuild.metainfo.CreatedBy
-	fs.CreatedOn = (time.Duration(metainfoBuild.metainfo.CreationDate) * time.Second).Nanoseconds()
-
-	t, err = client.AddTorrent(metainfoBuild.metainfo)
-	if err != nil {
-		return -1
-	}
-
-	fileUpdateCheck(t)
+	return defaultSession.CreateTorrentFromMetaInfo()
+}
 
-	return register(t)
+func CreateTorrentFromMetaInfoE() (int, error) {
+	return defaultSession.CreateTorrentFromMetaInfoE()
 }
 
 // AddMagnet
@@ -213,30 +98,11 @@ func CreateTorrentFromMetaInfo() int {
 //
 //export AddMagnet
 func AddMagnet(path string, magnet string) int {
-	mu.Lock()
-	defer mu.Unlock()
-
-	var t *torrent.Torrent
-	var spec *torrent.TorrentSpec
-
-	spec, err = torrent.TorrentSpecFromMagnetURI(magnet)
-	if err != nil {
-		return -1
-	}
-
-	if _, ok := filestorage[spec.InfoHash]; ok {
-		err = errors.New("Already exists")
-		return -1
-	}
-
-	registerFileStorage(spec.InfoHash, path)
-
-	t, _, err = client.AddTorrentSpec(spec)
-	if err != nil {
-		return -1
-	}
+	return defaultSession.AddMagnet(path, magnet)
+}
 
-	return register(t)
+func AddMagnetE(path string, magnet string) (int, error) {
+	return defaultSession.AddMagnetE(path, magnet)
 }
 
 // AddTorrent
@@ -245,48 +111,11 @@ func AddMagnet(path string, magnet string) int {
 //
 //export AddTorrentFromURL
 func AddTorrentFromURL(path string, url string) int {
-	mu.Lock()
-	defer mu.Unlock()
-
-	var t *torrent.Torrent
-	var mi *metainfo.MetaInfo
-
-	var resp *http.Response
-	resp, err = http.Get(url)
-	if err != nil {
-		return -1
-	}
-	defer resp.Body.Close()
-
-	mi, err = metainfo.Load(resp.Body)
-	if err != nil {
-		return -1
-	}
-
-	hash := mi.HashInfoBytes()
-
-	if _, ok := filestorage[hash]; ok {
-		err = errors.New("Already exists")
-		return -1
-	}
-
-	fs := registerFileStorage(hash, path)
-
-	fs.Comment = mi.Comment
-	fs.Creator = mi.CreatedBy
-	fs.CreatedOn = (time.Duration(mi.CreationDate) * time.Second).Nanoseconds()
-	for _, u := range mi.UrlList {
-		fs.UrlList = append(fs.UrlList, WebSeedUrl{Url: u})
-	}
-
-	t, err = client.AddTorrent(mi)
-	if err != nil {
-		return -1
-	}
-
-	fileUpdateCheck(t)
+	return defaultSession.AddTorrentFromURL(path, url)
+}
 
-	return register(t)
+func AddTorrentFromURLE(path string, url string) (int, error) {
+	return defaultSession.AddTorrentFromURLE(path, url)
 }
 
 // AddTorrent
@@ -295,104 +124,31 @@ func AddTorrentFromURL(path string, url string) int {
 //
 //export AddTorrent
 func AddTorrent(file string) int {
-	mu.Lock()
-	defer mu.Unlock()
-
-	var t *torrent.Torrent
-	var mi *metainfo.MetaInfo
-
-	mi, err = metainfo.LoadFromFile(file)
-	if err != nil {
-		return -1
-	}
-
-	hash := mi.HashInfoBytes()
-
-	if _, ok := filestorage[hash]; ok {
-		err = errors.New("Already exists")
-		return -1
-	}
-
-	fs := registerFileStorage(hash, path.Dir(file))
-
-	fs.Comment = mi.Comment
-	fs.Creator = mi.CreatedBy
-	fs.CreatedOn = (time.Duration(mi.CreationDate) * time.Second).Nanoseconds()
-	for _, u := range mi.UrlList {
-		fs.UrlList = append(fs.UrlList, WebSeedUrl{Url: u})
-	}
-
-	t, err = client.AddTorrent(mi)
-	if err != nil {
-		return -1
-	}
-
-	fileUpdateCheck(t)
+	return defaultSession.AddTorrent(file)
+}
 
-	return register(t)
+func AddTorrentE(file string) (int, error) {
+	return defaultSession.AddTorrentE(file)
 }
 
 //export AddTorrentFromBytes
 func AddTorrentFromBytes(path string, buf []byte) int {
-	mu.Lock()
-	defer mu.Unlock()
-
-	var t *torrent.Torrent
-	var mi *metainfo.MetaInfo
-
-	r := bytes.NewReader(buf)
-
-	mi, err = metainfo.Load(r)
-	if err != nil {
-		return -1
-	}
-
-	hash := mi.HashInfoBytes()
-
-	if _, ok := filestorage[hash]; ok {
-		err = errors.New("Already exists")
-		return -1
-	}
-
-	fs := registerFileStorage(hash, path)
-
-	fs.Comment = mi.Comment
-	fs.Creator = mi.CreatedBy
-	fs.CreatedOn = (time.Duration(mi.CreationDate) * time.Second).Nanoseconds()
-	for _, u := range mi.UrlList {
-		fs.UrlList = append(fs.UrlList, WebSeedUrl{Url: u})
-	}
-
-	t, err = client.AddTorrent(mi)
-	if err != nil {
-		return -1
-	}
-
-	fileUpdateCheck(t)
+	return defaultSession.AddTorrentFromBytes(path, buf)
+}
 
-	return register(t)
+func AddTorrentFromBytesE(path string, buf []byte) (int, error) {
+	return defaultSession.AddTorrentFromBytesE(path, buf)
 }
 
 // Get Torrent file from runtime torrent
 //
 //export GetTorrent
 func GetTorrent(i int) []byte {
-	mu.Lock()
-	defer mu.Unlock()
-
-	t := torrents[i]
+	return defaultSession.GetTorrent(i)
+}
 
-	var buf bytes.Buffer
-	w := bufio.NewWriter(&buf)
-	err = t.Metainfo().Write(w)
-	if err != nil {
-		return nil
-	}
-	err = w.Flush()
-	if err != nil {
-		return nil
-	}
-	return buf.Bytes()
+func GetTorrentE(i int) ([]byte, error) {
+	return defaultSession.GetTorrentE(i)
 }
 
 // Separate load / create torrent from network activity.
@@ -401,173 +157,33 @@ func GetTorrent(i int) []byte {
 //
 //export StartTorrent
 func StartTorrent(i int) bool {
-	mu.Lock()
-	defer mu.Unlock()
-
-	t := torrents[i]
-
-	if pause != nil {
-		pause[t] = StatusDownloading
-		return true
-	}
-
-	if _, ok := active[t]; ok {
-		return true
-	}
-
-	if len(active) >= ActiveCount {
-		// priority to start, seeding torrent will not start over downloading torrents
-		return queueStart(t)
-	}
-
-	return startTorrent(t)
+	return defaultSession.StartTorrent(i)
 }
 
-func startTorrent(t *torrent.Torrent) bool {
-	fs := filestorage[t.InfoHash()]
-
-	err = client.StartTorrent(t)
-	if err != nil {
-		return false
-	}
-
-	active[t] = time.Now().UnixNano()
-
-	lpdPeers(t)
-
-	lpdForce()
-
-	fs.ActivateDate = time.Now().UnixNano() // activate time now
-
-	go func() {
-		select {
-		case <-t.GotInfo():
-		case <-t.Wait():
-			return
-		}
-
-		mu.Lock()
-		defer mu.Unlock()
-
-		// update time between start and GotInfo
-		now := time.Now().UnixNano()
-		if pendingCompleted(t) { // seeding
-			fs.SeedingTime = fs.SeedingTime + (now - fs.ActivateDate)
-		} else { // downloading
-			fs.DownloadingTime = fs.DownloadingTime + (now - fs.ActivateDate)
-		}
-		fs.ActivateDate = now
-
-		fileUpdateCheck(t)
-	}()
-
-	go func() {
-		queueEngine(t)
-	}()
-
-	return true
+func StartTorrentE(i int) error {
+	return defaultSession.StartTorrentE(i)
 }
 
 // Download only metadata from magnet link and stop torrent
 //
 //export DownloadMetadata
 func DownloadMetadata(i int) bool {
-	mu.Lock()
-	defer mu.Unlock()
-
-	t := torrents[i]
-	fs := filestorage[t.InfoHash()]
-
-	if _, ok := active[t]; ok {
-		return true
-	}
-
-	err = client.StartTorrent(t)
-	if err != nil {
-		return false
-	}
-
-	fs.ActivateDate = time.Now().UnixNano()
-
-	go func() {
-		select {
-		case <-t.GotInfo():
-		case <-t.Wait():
-			return
-		}
-
-		mu.Lock()
-		defer mu.Unlock()
-
-		now := time.Now().UnixNano()
-		if pendingCompleted(t) { // seeding
-			fs.SeedingTime = fs.SeedingTime + (now - fs.ActivateDate)
-		} else { // downloading
-			fs.DownloadingTime = fs.DownloadingTime + (now - fs.ActivateDate)
-		}
-		fs.ActivateDate = now
-
-		fileUpdateCheck(t)
-		t.Drop()
-	}()
+	return defaultSession.DownloadMetadata(i)
+}
 
-	return true
+func DownloadMetadataE(i int) error {
+	return defaultSession.DownloadMetadataE(i)
 }
 
 func MetaTorrent(i int) bool {
-	mu.Lock()
-	defer mu.Unlock()
-
-	t := torrents[i]
-	return t.Info() != nil
+	return defaultSession.MetaTorrent(i)
 }
 
 // Stop torrent from announce, check, seed, download
 //
 //export StopTorrent
 func StopTorrent(i int) {
-	mu.Lock()
-	defer mu.Unlock()
-
-	t := torrents[i]
-
-	defer delete(queue, t) // delete queued torrent from queue (seeded will be removed by queueEngine)
-
-	if stopTorrent(t) { // we sholuld not call queueNext on suspend torrent, otherwise it overlap ActiveTorrent
-		if pause != nil {
-			return
-		}
-		queueNext(nil)
-	}
-}
-
-func stopTorrent(t *torrent.Torrent) bool {
-	if pause != nil {
-		delete(pause, t)
-	}
-
-	info := t.InfoHash()
-
-	fs := filestorage[info]
-
-	webSeedStop(t)
-
-	if _, ok := active[t]; ok {
-		s := pendingCompleted(t) // seeding
-		t.Drop()
-		now := time.Now().UnixNano()
-		if s {
-			fs.SeedingTime = fs.SeedingTime + (now - fs.ActivateDate)
-		} else {
-			fs.DownloadingTime = fs.DownloadingTime + (now - fs.ActivateDate)
-		}
-		fs.ActivateDate = now
-		delete(active, t)
-		return true
-	} else {
-		t.Stop()
-		return false
-	}
+	defaultSession.StopTorrent(i)
 }
 
 // CheckTorrent
@@ -577,116 +193,40 @@ func stopTorrent(t *torrent.Torrent) bool {
 //
 //export CheckTorrent
 func CheckTorrent(i int) {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
-
-	torrentstorageLock.Lock()
-	ts := torrentstorage[t.InfoHash()]
-	ts.completedPieces.Clear()
-	ts.completed = false
-	torrentstorageLock.Unlock()
-
-	fb := filePendingBitmap(t.InfoHash())
-
-	client.CheckTorrent(t, fb)
+	defaultSession.CheckTorrent(i)
 }
 
 // Remote torrent for library
 //
 //export RemoveTorrent
 func RemoveTorrent(i int) {
-	mu.Lock()
-	defer mu.Unlock()
-
-	t := torrents[i]
+	defaultSession.RemoveTorrent(i)
+}
 
-	stopTorrent(t)
+// RemoveTorrentData
+//
+// Remove torrent from library and delete its files from disk / external
+// storage.
+//
+//export RemoveTorrentData
+func RemoveTorrentData(i int) bool {
+	return defaultSession.RemoveTorrentData(i)
+}
 
-	unregister(i)
+func RemoveTorrentDataE(i int) error {
+	return defaultSession.RemoveTorrentDataE(i)
 }
 
 func WaitAll() bool {
-	mu.Lock()
-	c := client
-	if c == nil {
-		mu.Unlock()
-		return true
-	}
-	mu.Unlock()
-	return c.WaitAll()
+	return defaultSession.WaitAll()
 }
 
 //export Error
 func Error() string {
-	mu.Lock()
-	defer mu.Unlock()
-
-	if err != nil {
-		return err.Error()
-	}
-	return ""
+	return defaultSession.Error()
 }
 
 //export Close
 func Close() {
-	mu.Lock()
-	defer mu.Unlock()
-
-	mappingStop()
-
-	lpdStop()
-
-	clientAddr = ""
-
-	if client != nil {
-		client.Close()
-		client = nil
-	}
-}
-
-//
-// protected
-//
-
-var clientConfig *torrent.ClientConfig
-var client *torrent.Client
-var clientAddr string
-var err error
-var torrents map[int]*torrent.Torrent
-var active map[*torrent.Torrent]int64
-var index int
-var mu sync.Mutex
-var pause map[*torrent.Torrent]int32
-
-func register(t *torrent.Torrent) int {
-	index++
-	for torrents[index] != nil {
-		index++
-	}
-	torrents[index] = t
-
-	t.SetMaxConns(SocketsPerTorrent)
-
-	return index
-}
-
-func unregister(i int) {
-	t := torrents[i]
-
-	info := t.InfoHash()
-
-	delete(filestorage, info)
-
-	torrentstorageLock.Lock()
-	delete(torrentstorage, info)
-	torrentstorageLock.Unlock()
-
-	delete(active, t)
-
-	delete(queue, t)
-
-	delete(pause, t)
-
-	delete(torrents, i)
+	defaultSession.Close()
 }
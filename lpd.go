@@ -16,8 +16,6 @@ import (
 	"github.com/anacrolix/torrent/metainfo"
 )
 
-var lpd *LPDServer
-
 // http://bittorrent.org/beps/bep_0014.html
 
 // TODO http://bittorrent.org/beps/bep_0026.html
@@ -38,6 +36,8 @@ const (
 )
 
 type LPDConn struct {
+	s *Session
+
 	stop  missinggo.Event
 	force missinggo.Event
 
@@ -47,8 +47,8 @@ type LPDConn struct {
 	host    string // bep14_host4 or bep14_host6
 }
 
-func lpdConnNew(network string, host string) *LPDConn {
-	m := &LPDConn{}
+func (s *Session) lpdConnNew(network string, host string) *LPDConn {
+	m := &LPDConn{s: s}
 
 	m.network = network
 	m.host = host
@@ -71,13 +71,13 @@ func lpdConnNew(network string, host string) *LPDConn {
 
 func (m *LPDConn) receiver() {
 	for {
-		mu.Lock()
+		m.s.mu.Lock()
 		conn := m.conn
 		if conn == nil {
-			mu.Unlock()
+			m.s.mu.Unlock()
 			return
 		}
-		mu.Unlock()
+		m.s.mu.Unlock()
 
 		buf := make([]byte, 2000)
 		_, from, err := conn.ReadFromUDP(buf)
@@ -116,30 +116,30 @@ func (m *LPDConn) receiver() {
 			continue
 		}
 
-		mu.Lock()
-		if lpd == nil { // can be closed already
-			mu.Unlock()
+		m.s.mu.Lock()
+		if m.s.lpd == nil { // can be closed already
+			m.s.mu.Unlock()
 			return
 		}
-		lpd.peer(addr.String())
-		lpd.refresh()
+		m.s.lpd.peer(addr.String())
+		m.s.lpd.refresh()
 		//log.Println("LPD", m.network, addr.String(), ih)
 		ignore := make(map[*torrent.Torrent]bool)
 		for _, ih := range ihs {
 			hash := metainfo.NewHashFromHex(ih)
-			if t, ok := client.Torrent(hash); ok {
+			if t, ok := m.s.client.Torrent(hash); ok {
 				lpdPeer(t, addr.String())
 				ignore[t] = true
 			}
 		}
 		// LPD is the only source of local IP's. So, add it to all active torrents.
-		for t := range active {
+		for t := range m.s.active {
 			if _, ok := ignore[t]; ok {
 				continue
 			}
 			lpdPeer(t, addr.String())
 		}
-		mu.Unlock()
+		m.s.mu.Unlock()
 	}
 }
 
@@ -149,22 +149,26 @@ func (m *LPDConn) announcer() {
 	var queue []*torrent.Torrent
 
 	for {
-		mu.Lock()
+		m.s.mu.Lock()
 		m.force.Clear()
-		mu.Unlock()
+		m.s.mu.Unlock()
 
 		//log.Println("LPD", refresh)
 
 		select {
-		case <-m.stop.LockedChan(&mu):
+		case <-m.stop.LockedChan(&m.s.mu):
 			return
-		case <-m.force.LockedChan(&mu):
+		case <-m.force.LockedChan(&m.s.mu):
 		case <-time.After(refresh):
 		}
 
-		mu.Lock()
+		m.s.mu.Lock()
+		if m.s.lpd == nil { // closed while forced
+			m.s.mu.Unlock()
+			return
+		}
 		// add missing torrent to send queue
-		for t := range active {
+		for t := range m.s.active {
 			if _, ok := lpdContains(queue, t); !ok {
 				queue = append(queue, t)
 			}
@@ -179,7 +183,7 @@ func (m *LPDConn) announcer() {
 		// remove stopped torrent from queue
 		var remove []*torrent.Torrent
 		for _, t := range queue {
-			if _, ok := active[t]; !ok {
+			if _, ok := m.s.active[t]; !ok {
 				remove = append(remove, t)
 			}
 		}
@@ -196,14 +200,14 @@ func (m *LPDConn) announcer() {
 				queue = append(queue[:i], queue[i+1:]...)
 			}
 		}
-		lpd.refresh()
+		m.s.lpd.refresh()
 
 		var ihs string
 		var old []byte
 
-		_, port, err := net.SplitHostPort(clientAddr)
+		_, port, err := net.SplitHostPort(m.s.clientAddr)
 		if err != nil {
-			mu.Unlock()
+			m.s.mu.Unlock()
 			log.Println("announcer", err)
 			continue
 		}
@@ -229,7 +233,7 @@ func (m *LPDConn) announcer() {
 				break
 			}
 		}
-		mu.Unlock()
+		m.s.mu.Unlock()
 
 		if len(old) > 0 {
 			//log.Println("LPD", string(old), len(old))
@@ -240,7 +244,7 @@ func (m *LPDConn) announcer() {
 		}
 
 		// sholud we wait for 5 min or 1 min, if we still announcing
-		refresh = bep14_short_timeout
+		refresh = time.Duration(m.s.cfg.LPDShortTimeout) * time.Nanosecond
 		if next == nil { // restart queue
 			refresh = bep14_long_timeout
 		}
@@ -262,22 +266,22 @@ type LPDServer struct {
 	peers map[int64]string // active local peers
 }
 
-func lpdStart() {
-	lpd = &LPDServer{}
+func (s *Session) lpdStart() {
+	s.lpd = &LPDServer{}
 
-	lpd.peers = make(map[int64]string)
+	s.lpd.peers = make(map[int64]string)
 
-	lpd.conn4 = lpdConnNew("udp4", bep14_host4)
-	if lpd.conn4 != nil {
-		go lpd.conn4.receiver()
-		go lpd.conn4.announcer()
+	s.lpd.conn4 = s.lpdConnNew("udp4", bep14_host4)
+	if s.lpd.conn4 != nil {
+		go s.lpd.conn4.receiver()
+		go s.lpd.conn4.announcer()
 
 	}
 
-	lpd.conn6 = lpdConnNew("udp6", bep14_host6)
-	if lpd.conn6 != nil {
-		go lpd.conn6.receiver()
-		go lpd.conn6.announcer()
+	s.lpd.conn6 = s.lpdConnNew("udp6", bep14_host6)
+	if s.lpd.conn6 != nil {
+		go s.lpd.conn6.receiver()
+		go s.lpd.conn6.announcer()
 	}
 
 	return
@@ -323,37 +327,37 @@ func lpdContains(queue []*torrent.Torrent, e *torrent.Torrent) (int, bool) {
 	return -1, false
 }
 
-func lpdForce() {
-	if lpd.conn4 != nil {
-		lpd.conn4.force.Set()
+func (s *Session) lpdForce() {
+	if s.lpd.conn4 != nil {
+		s.lpd.conn4.force.Set()
 	}
-	if lpd.conn6 != nil {
-		lpd.conn6.force.Set()
+	if s.lpd.conn6 != nil {
+		s.lpd.conn6.force.Set()
 	}
 }
 
-func lpdStop() {
-	if lpd != nil {
-		if lpd.conn4 != nil {
-			lpd.conn4.Close()
-			lpd.conn4 = nil
+func (s *Session) lpdStop() {
+	if s.lpd != nil {
+		if s.lpd.conn4 != nil {
+			s.lpd.conn4.Close()
+			s.lpd.conn4 = nil
 		}
-		if lpd.conn6 != nil {
-			lpd.conn6.Close()
-			lpd.conn6 = nil
+		if s.lpd.conn6 != nil {
+			s.lpd.conn6.Close()
+			s.lpd.conn6 = nil
 		}
-		lpd = nil
+		s.lpd = nil
 	}
 }
 
-func lpdPeers(t *torrent.Torrent) {
-	for _, p := range lpd.peers {
+func (s *Session) lpdPeers(t *torrent.Torrent) {
+	for _, p := range s.lpd.peers {
 		lpdPeer(t, p)
 	}
 }
 
-func lpdCount(hash metainfo.Hash) int {
-	return len(lpd.peers)
+func (s *Session) lpdCount(hash metainfo.Hash) int {
+	return len(s.lpd.peers)
 }
 
 func lpdPeer(t *torrent.Torrent, p string) {
@@ -63,13 +63,15 @@ func (m *defaultMetainfoBuilder) Root() string {
 }
 
 func (m *defaultMetainfoBuilder) FilesCount() (int, error) {
-	err = filepath.Walk(m.root, func(path string, fi os.FileInfo, err error) error {
+	err := filepath.Walk(m.root, func(path string, fi os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 		if fi.IsDir() { // Directories are implicit in torrent files.
 			return nil
 		} else if path == m.root { // The root is a file.
+			m.fn = append(m.fn, fi.Name())
+			m.fl = append(m.fl, fi.Size())
 			return nil
 		}
 		relPath, err := filepath.Rel(m.root, path)
@@ -91,11 +93,13 @@ func (m *defaultMetainfoBuilder) FilesLength(i int) int64 {
 	return m.fl[i]
 }
 
+// 'path' starts with torrent name, relative to Root()
 func (m *defaultMetainfoBuilder) ReadFileAt(path string, buf *Buffer, off int64) (n int, err error) {
-	f, err := os.Open(filepath.Join(m.root, path))
+	f, err := os.Open(filepath.Join(filepath.Dir(m.root), path))
 	if err != nil {
 		return 0, err
 	}
+	defer f.Close()
 	_, err = f.Seek(off, io.SeekStart)
 	if err != nil {
 		return 0, err
@@ -111,8 +115,6 @@ type metainfoBuilder struct {
 	last     int
 }
 
-var metainfoBuild *metainfoBuilder
-
 // transmissionbt/makemeta.c
 func bestPieceSize(totalSize int64) int64 {
 	var KiB int64 = 1024
@@ -141,73 +143,81 @@ func bestPieceSize(totalSize int64) int64 {
 
 //export CreateMetaInfo
 func CreateMetainfo(root string) int {
-	return CreateMetainfoBuilder(&defaultMetainfoBuilder{root: root})
+	return defaultSession.CreateMetainfo(root)
+}
+
+func (s *Session) CreateMetainfo(root string) int {
+	return s.CreateMetainfoBuilder(&defaultMetainfoBuilder{root: root})
 }
 
 //export CreateMetaInfo
 func CreateMetainfoBuilder(b MetainfoBuilder) int {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.CreateMetainfoBuilder(b)
+}
 
-	metainfoBuild = &metainfoBuilder{}
+func (s *Session) CreateMetainfoBuilder(b MetainfoBuilder) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	metainfoBuild.info = &metainfo.Info{}
-	metainfoBuild.metainfo = &metainfo.MetaInfo{
-		AnnounceList: builtinAnnounceList,
+	s.metainfoBuild = &metainfoBuilder{}
+
+	s.metainfoBuild.info = &metainfo.Info{}
+	s.metainfoBuild.metainfo = &metainfo.MetaInfo{
+		AnnounceList: s.announceList,
 	}
-	metainfoBuild.b = b
+	s.metainfoBuild.b = b
 
 	var size int64 = 0
 
-	metainfoBuild.info.Name = b.Name()
-	metainfoBuild.info.Files = nil
+	s.metainfoBuild.info.Name = b.Name()
+	s.metainfoBuild.info.Files = nil
 	var c int
-	c, err = b.FilesCount()
-	if err != nil {
+	c, s.err = b.FilesCount()
+	if s.err != nil {
 		return -1
 	}
 	if c == 1 {
 		size = b.FilesLength(0)
-		metainfoBuild.info.Length = size // size of the file in bytes (only when one file is being shared)
+		s.metainfoBuild.info.Length = size // size of the file in bytes (only when one file is being shared)
 	} else {
 		for i := 0; i < c; i++ {
-			metainfoBuild.info.Files = append(metainfoBuild.info.Files, metainfo.FileInfo{
+			s.metainfoBuild.info.Files = append(s.metainfoBuild.info.Files, metainfo.FileInfo{
 				Path:   strings.Split(b.FilesName(i), string(filepath.Separator)),
 				Length: b.FilesLength(i),
 			})
 			size = size + b.FilesLength(i)
 		}
 	}
-	if err != nil {
+	if s.err != nil {
 		return -1
 	}
-	slices.Sort(metainfoBuild.info.Files, func(l, r metainfo.FileInfo) bool {
+	slices.Sort(s.metainfoBuild.info.Files, func(l, r metainfo.FileInfo) bool {
 		return strings.Join(l.Path, "/") < strings.Join(r.Path, "/")
 	})
 
 	if size == 0 {
-		err = fmt.Errorf("zero torrent size")
+		s.err = fmt.Errorf("zero torrent size")
 		return -1
 	}
 
 	private := false
 
-	metainfoBuild.info.Private = &private
-	metainfoBuild.info.PieceLength = bestPieceSize(size)
-	metainfoBuild.metainfo.Comment = ""
-	metainfoBuild.metainfo.CreatedBy = "libtorrent"
-	metainfoBuild.metainfo.CreationDate = time.Now().Unix()
+	s.metainfoBuild.info.Private = &private
+	s.metainfoBuild.info.PieceLength = bestPieceSize(size)
+	s.metainfoBuild.metainfo.Comment = ""
+	s.metainfoBuild.metainfo.CreatedBy = "libtorrent"
+	s.metainfoBuild.metainfo.CreationDate = time.Now().Unix()
 
 	open := func(fi metainfo.FileInfo) (io.ReadCloser, error) {
-		name := metainfoBuild.info.Name // use original name
+		name := s.metainfoBuild.info.Name // use original name
 		return &metainfoBuilderReader{b: b, path: filepath.Join(strings.Join(append([]string{name}, fi.Path...), string(filepath.Separator)))}, nil
 	}
 
 	var pw *io.PipeWriter
-	metainfoBuild.pr, pw = io.Pipe()
+	s.metainfoBuild.pr, pw = io.Pipe()
 	go func() {
 		var err error
-		for _, fi := range metainfoBuild.info.UpvertedFiles() {
+		for _, fi := range s.metainfoBuild.info.UpvertedFiles() {
 			var r io.ReadCloser
 			r, err = open(fi)
 			if err != nil {
@@ -225,62 +235,66 @@ func CreateMetainfoBuilder(b MetainfoBuilder) int {
 		pw.CloseWithError(err)
 	}()
 
-	s := size / metainfoBuild.info.PieceLength
-	r := size % metainfoBuild.info.PieceLength
+	n := size / s.metainfoBuild.info.PieceLength
+	r := size % s.metainfoBuild.info.PieceLength
 	if r > 0 { // remaining piece
-		s++
+		n++
 	}
-	metainfoBuild.last = int(s) - 1
-	return int(s)
+	s.metainfoBuild.last = int(n) - 1
+	return int(n)
 }
 
 //export HashMetaInfo
 func HashMetaInfo(piece int) bool {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.HashMetaInfo(piece)
+}
+
+func (s *Session) HashMetaInfo(piece int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	var wn int64
 
-	if metainfoBuild.pr == nil {
-		err = errors.New("pr nil")
+	if s.metainfoBuild.pr == nil {
+		s.err = errors.New("pr nil")
 		return false
 	}
 
 	hasher := sha1.New()
-	wn, err = io.CopyN(hasher, metainfoBuild.pr, metainfoBuild.info.PieceLength)
-	if err == io.EOF {
-		err = nil
+	wn, s.err = io.CopyN(hasher, s.metainfoBuild.pr, s.metainfoBuild.info.PieceLength)
+	if s.err == io.EOF {
+		s.err = nil
 	}
-	if err != nil {
-		metainfoBuild.pr.Close()
-		metainfoBuild.pr = nil
+	if s.err != nil {
+		s.metainfoBuild.pr.Close()
+		s.metainfoBuild.pr = nil
 		return false
 	}
 	if wn == 0 {
-		metainfoBuild.pr.Close()
-		metainfoBuild.pr = nil
-		metainfoBuild.metainfo.InfoBytes, err = bencode.Marshal(metainfoBuild.info)
-		if err != nil {
-			panic(err)
+		s.metainfoBuild.pr.Close()
+		s.metainfoBuild.pr = nil
+		s.metainfoBuild.metainfo.InfoBytes, s.err = bencode.Marshal(s.metainfoBuild.info)
+		if s.err != nil {
+			panic(s.err)
 		}
 		return true
 	}
-	metainfoBuild.info.Pieces = hasher.Sum(metainfoBuild.info.Pieces)
-	if wn < metainfoBuild.info.PieceLength {
-		metainfoBuild.pr.Close()
-		metainfoBuild.pr = nil
-		metainfoBuild.metainfo.InfoBytes, err = bencode.Marshal(metainfoBuild.info)
-		if err != nil {
-			panic(err)
+	s.metainfoBuild.info.Pieces = hasher.Sum(s.metainfoBuild.info.Pieces)
+	if wn < s.metainfoBuild.info.PieceLength {
+		s.metainfoBuild.pr.Close()
+		s.metainfoBuild.pr = nil
+		s.metainfoBuild.metainfo.InfoBytes, s.err = bencode.Marshal(s.metainfoBuild.info)
+		if s.err != nil {
+			panic(s.err)
 		}
 		return true
 	}
-	if piece == metainfoBuild.last {
-		metainfoBuild.pr.Close()
-		metainfoBuild.pr = nil
-		metainfoBuild.metainfo.InfoBytes, err = bencode.Marshal(metainfoBuild.info)
-		if err != nil {
-			panic(err)
+	if piece == s.metainfoBuild.last {
+		s.metainfoBuild.pr.Close()
+		s.metainfoBuild.pr = nil
+		s.metainfoBuild.metainfo.InfoBytes, s.err = bencode.Marshal(s.metainfoBuild.info)
+		if s.err != nil {
+			panic(s.err)
 		}
 		return true
 	}
@@ -289,12 +303,16 @@ func HashMetaInfo(piece int) bool {
 
 //export CloseMetaInfo
 func CloseMetaInfo() {
-	mu.Lock()
-	defer mu.Unlock()
+	defaultSession.CloseMetaInfo()
+}
+
+func (s *Session) CloseMetaInfo() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if metainfoBuild.pr != nil {
-		metainfoBuild.pr.Close()
-		metainfoBuild.pr = nil
+	if s.metainfoBuild.pr != nil {
+		s.metainfoBuild.pr.Close()
+		s.metainfoBuild.pr = nil
 	}
-	metainfoBuild = nil
+	s.metainfoBuild = nil
 }
@@ -0,0 +1,328 @@
+package libtorrent
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// MoveStatus
+//
+// TorrentMoveStorage progress, bytes.
+type MoveStatus struct {
+	Moving bool
+	Done   int64
+	Total  int64
+}
+
+type moveFile struct {
+	rel    string // path relative to download folder
+	src    string
+	dst    string
+	length int64
+	copied bool // moved by copy (different filesystems), source removed after all files moved
+	done   bool
+}
+
+// TorrentMoveStorage
+//
+// Move torrent data to new download folder. Torrent stopped during move and
+// started back after. Works across filesystems (copy), on error all moved
+// files are moved back. Blocking call, use TorrentMoveStorageProgress() from
+// another thread to track progress.
+//
+// For external storage FileStorageTorrent.Move() called for every torrent
+// file, with path relative to download folder.
+//
+//export TorrentMoveStorage
+func TorrentMoveStorage(i int, path string) bool {
+	return defaultSession.TorrentMoveStorage(i, path)
+}
+
+func (s *Session) TorrentMoveStorage(i int, path string) bool {
+	err := s.TorrentMoveStorageE(i, path)
+	s.setError(err)
+	return err == nil
+}
+
+func TorrentMoveStorageE(i int, path string) error {
+	return defaultSession.TorrentMoveStorageE(i, path)
+}
+
+func (s *Session) TorrentMoveStorageE(i int, path string) error {
+	s.mu.Lock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	hash := t.InfoHash()
+
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[hash]
+	if ts.moving != nil {
+		s.torrentstorageLock.Unlock()
+		s.mu.Unlock()
+		return ErrMoving
+	}
+	old := ts.path
+	if filepath.Clean(old) == filepath.Clean(path) {
+		s.torrentstorageLock.Unlock()
+		s.mu.Unlock()
+		return nil
+	}
+	if ts.info == nil { // no metadata, no files yet
+		ts.path = path
+		ts.dirty = true
+		s.torrentstorageLock.Unlock()
+		s.mu.Unlock()
+		return nil
+	}
+	var files []*moveFile
+	var total int64
+	for k, fi := range ts.info.UpvertedFiles() {
+		rel := ts.fileRel(k, fi)
+		files = append(files, &moveFile{rel: rel, src: filepath.Join(old, rel), dst: filepath.Join(path, rel), length: fi.Length})
+		total += fi.Length
+	}
+	ts.moving = &MoveStatus{Moving: true, Total: total}
+	s.torrentstorageLock.Unlock()
+
+	// pause torrent io
+	_, active := s.active[t]
+	forced := s.forced[t]
+	queued, inQueue := s.queue[t]
+	delete(s.queue, t)
+	if active {
+		s.stopTorrent(t)
+	}
+	s.eventStatus()
+	external := s.storageExternal
+
+	s.mu.Unlock()
+
+	if external != nil {
+		err = s.moveExternal(external, hash.HexString(), ts, old, path, files)
+	} else {
+		err = s.moveFiles(ts, old, path, files)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.torrentstorageLock.Lock()
+	if err == nil {
+		ts.path = path
+		ts.dirty = true
+	}
+	ts.moving = nil
+	s.torrentstorageLock.Unlock()
+
+	if _, ok := s.torrents[i]; !ok { // removed during move
+		return err
+	}
+
+	// resume
+	if inQueue {
+		s.queue[t] = queued
+	}
+	if active {
+		if forced {
+			s.forced[t] = true
+		}
+		if err1 := s.startTorrent(t); err1 != nil {
+			delete(s.forced, t)
+			s.queue[t] = time.Now().UnixNano()
+			if err == nil {
+				err = err1
+			}
+		}
+	}
+	s.eventStatus()
+
+	return err
+}
+
+// TorrentMoveStorageProgress
+//
+//export TorrentMoveStorageProgress
+func TorrentMoveStorageProgress(i int) *MoveStatus {
+	return defaultSession.TorrentMoveStorageProgress(i)
+}
+
+func (s *Session) TorrentMoveStorageProgress(i int) *MoveStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return nil
+	}
+
+	s.torrentstorageLock.Lock()
+	defer s.torrentstorageLock.Unlock()
+
+	ts := s.torrentstorage[t.InfoHash()]
+	if ts.moving == nil {
+		return &MoveStatus{}
+	}
+	m := *ts.moving
+	return &m
+}
+
+func (s *Session) moveProgress(ts *torrentStorage, n int64) {
+	s.torrentstorageLock.Lock()
+	ts.moving.Done += n
+	s.torrentstorageLock.Unlock()
+}
+
+// move local files from 'src' to 'dst' folder, roll back on error
+func (s *Session) moveFiles(ts *torrentStorage, src, dst string, files []*moveFile) error {
+	for _, f := range files {
+		if _, err := os.Stat(f.dst); err == nil {
+			return ErrAlreadyExists
+		}
+	}
+
+	var err error
+	for _, f := range files {
+		if _, err = os.Stat(f.src); os.IsNotExist(err) { // not downloaded yet
+			err = nil
+			s.moveProgress(ts, f.length)
+			continue
+		}
+		err = os.MkdirAll(filepath.Dir(f.dst), 0770)
+		if err != nil {
+			break
+		}
+		if os.Rename(f.src, f.dst) == nil {
+			f.done = true
+			s.moveProgress(ts, f.length)
+			continue
+		}
+		// different filesystems
+		f.copied = true
+		err = s.moveCopy(ts, f.src, f.dst)
+		if err != nil {
+			os.Remove(f.dst)
+			break
+		}
+		f.done = true
+	}
+
+	if err != nil { // roll back
+		for _, f := range files {
+			if !f.done {
+				continue
+			}
+			if f.copied {
+				os.Remove(f.dst) // source still in place
+			} else {
+				os.Rename(f.dst, f.src)
+			}
+		}
+		var dd []string
+		for _, f := range files {
+			dd = append(dd, f.dst)
+		}
+		removeEmptyDirs(dst, dd)
+		return err
+	}
+
+	for _, f := range files {
+		if f.done && f.copied {
+			os.Remove(f.src)
+		}
+	}
+	var ss []string
+	for _, f := range files {
+		ss = append(ss, f.src)
+	}
+	removeEmptyDirs(src, ss)
+
+	return nil
+}
+
+// move external storage files from 'src' to 'dst' folder, roll back on error
+func (s *Session) moveExternal(ext FileStorageTorrent, hash string, ts *torrentStorage, src, dst string, files []*moveFile) error {
+	var err error
+	for _, f := range files {
+		err = ext.Move(hash, f.rel, src, dst)
+		if err != nil {
+			break
+		}
+		f.done = true
+		s.moveProgress(ts, f.length)
+	}
+
+	if err != nil { // roll back
+		for _, f := range files {
+			if f.done {
+				ext.Move(hash, f.rel, dst, src)
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *Session) moveCopy(ts *torrentStorage, src, dst string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0660)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				w.Close()
+				return err
+			}
+			s.moveProgress(ts, int64(n))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.Close()
+			return err
+		}
+	}
+	err = w.Sync()
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// remove folders left empty after files removal, deepest first. 'root' folder
+// kept.
+func removeEmptyDirs(root string, files []string) {
+	root = filepath.Clean(root)
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		for d := filepath.Dir(f); d != root && d != filepath.Dir(d); d = filepath.Dir(d) {
+			dirs[d] = true
+		}
+	}
+	for len(dirs) > 0 {
+		var deep string
+		for d := range dirs {
+			if len(d) > len(deep) {
+				deep = d
+			}
+		}
+		os.Remove(deep) // fails on non empty folders, keep user files
+		delete(dirs, deep)
+	}
+}
@@ -0,0 +1,113 @@
+package libtorrent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveFiles(t *testing.T) {
+	src, err := ioutil.TempDir("", "libtorrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	dst, err := ioutil.TempDir("", "libtorrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	os.MkdirAll(filepath.Join(src, "t", "a"), 0770)
+	ioutil.WriteFile(filepath.Join(src, "t", "a", "1.txt"), []byte("123"), 0660)
+
+	files := []*moveFile{
+		{src: filepath.Join(src, "t", "a", "1.txt"), dst: filepath.Join(dst, "t", "a", "1.txt"), length: 3},
+		{src: filepath.Join(src, "t", "2.txt"), dst: filepath.Join(dst, "t", "2.txt"), length: 5}, // not downloaded
+	}
+
+	s := &Session{}
+	ts := &torrentStorage{moving: &MoveStatus{Moving: true, Total: 8}}
+	err = s.moveFiles(ts, src, dst, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts.moving.Done != 8 {
+		t.Error(ts.moving.Done)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "t", "a", "1.txt")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "t")); !os.IsNotExist(err) {
+		t.Error("source folder left", err)
+	}
+
+	// destination exists, nothing moved back
+	for _, f := range files {
+		f.src, f.dst = f.dst, f.src
+		f.done = false
+	}
+	os.MkdirAll(filepath.Join(src, "t"), 0770)
+	ioutil.WriteFile(filepath.Join(src, "t", "2.txt"), []byte("12345"), 0660)
+	err = s.moveFiles(ts, dst, src, files)
+	if err != ErrAlreadyExists {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "t", "a", "1.txt")); err != nil {
+		t.Error(err)
+	}
+}
+
+type moveStorage struct {
+	FileStorageTorrent
+	files map[string]string // path -> download folder
+	fail  string
+}
+
+func (m *moveStorage) Move(hash string, path string, old string, dir string) error {
+	if path == m.fail {
+		return ErrBadState
+	}
+	if m.files[path] != old {
+		return ErrUnknownFile
+	}
+	m.files[path] = dir
+	return nil
+}
+
+func TestMoveExternal(t *testing.T) {
+	ext := &moveStorage{files: map[string]string{"t/1.txt": "/a", "t/2.txt": "/a"}}
+	files := []*moveFile{
+		{rel: "t/1.txt", length: 3},
+		{rel: "t/2.txt", length: 5},
+	}
+
+	s := &Session{}
+	ts := &torrentStorage{moving: &MoveStatus{Moving: true, Total: 8}}
+	err := s.moveExternal(ext, "hash", ts, "/a", "/b", files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts.moving.Done != 8 {
+		t.Error(ts.moving.Done)
+	}
+	for p, d := range ext.files {
+		if d != "/b" {
+			t.Error(p, d)
+		}
+	}
+
+	// second file fails, first moved back
+	for _, f := range files {
+		f.done = false
+	}
+	ext.fail = "t/2.txt"
+	err = s.moveExternal(ext, "hash", ts, "/b", "/c", files)
+	if err != ErrBadState {
+		t.Error(err)
+	}
+	if d := ext.files["t/1.txt"]; d != "/b" {
+		t.Error(d)
+	}
+}
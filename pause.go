@@ -8,88 +8,129 @@ import (
 )
 
 func Pause() {
-	mu.Lock()
-	defer mu.Unlock()
+	defaultSession.Pause()
+}
+
+func (s *Session) Pause() {
+	defer s.autosave(true) // after torrents stopped and lock released
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if pause == nil {
-		pause = make(map[*torrent.Torrent]int32)
+	defer s.eventStatus()
+
+	if s.pause == nil {
+		s.pause = make(map[*torrent.Torrent]int32)
 	}
 
-	for _, t := range torrents {
-		if _, ok := pause[t]; ok {
+	for _, t := range s.torrents {
+		if _, ok := s.pause[t]; ok {
 			continue
 		}
-		s := torrentStatus(t)
-		switch s {
+		status := s.torrentStatus(t)
+		switch status {
 		case StatusPaused:
 			// ignore
 		case StatusChecking:
 			// ignore
 		default:
-			delete(queue, t)
-			stopTorrent(t)
-			pause[t] = s
+			delete(s.queue, t)
+			s.stopTorrent(t)
+			s.pause[t] = status
 		}
 	}
 
-	mappingStop()
+	s.mappingStop()
 }
 
 func Resume() {
-	mu.Lock()
-	defer mu.Unlock()
+	defaultSession.Resume()
+}
+
+func (s *Session) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer s.eventStatus()
 
 	// every time application call resume() means network configuration changed.
 	// we need to check if network interfaces / local mapping port were updated. and restart port mapping if so.
-	ips := portList()
-	if !reflect.DeepEqual(mappingAddr, ips) {
-		mappingAddr = ips
+	ips := s.portList()
+	if !reflect.DeepEqual(s.mappingAddr, ips) {
+		s.mappingAddr = ips
 
-		lpdForce()
+		s.lpdForce()
 
 		go func() {
-			mappingPort(1 * time.Second)
-			mappingStart()
+			s.mappingPort(1 * time.Second)
+			s.mappingStart()
 		}()
 	}
 
-	if pause == nil {
+	if s.pause == nil {
 		return
 	}
 
+	s.resumeTorrents(s.pause)
+	s.pause = nil
+}
+
+// start torrents with saved statuses in queue order: active first, queued
+// second. lock outside.
+func (s *Session) resumeTorrents(statuses map[*torrent.Torrent]int32) {
 	now := time.Now().UnixNano()
 
+	l := s.queueOrder()
+
 	// at first resume active
-	for t, s := range pause {
-		switch s {
+	for _, t := range l {
+		status, ok := statuses[t]
+		if !ok {
+			continue
+		}
+		switch status {
+		case StatusPaused:
 		case StatusQueued:
+		case StatusForced:
+			s.forced[t] = true
+			if s.startTorrent(t) != nil { // problem starting? unable to report error. queue it manually.
+				delete(s.forced, t)
+				s.queue[t] = now
+			}
 		default:
-			if !queueStart(t) { // problem starting? unable to report error. queue it manually.
-				queue[t] = now
+			if s.queueStart(t) != nil { // problem starting? unable to report error. queue it manually.
+				s.queue[t] = now
 			}
 		}
 	}
 	// second run resume queued
-	for t, s := range pause {
-		switch s {
+	for _, t := range l {
+		status, ok := statuses[t]
+		if !ok {
+			continue
+		}
+		switch status {
 		case StatusQueued:
 			// user can remove active torrents from queue while paused.
 			// so we may still have slots available after 'resume active' step. start until we full.
-			if len(active) < ActiveCount {
-				if !startTorrent(t) { // problem starting? unable to report error. queue it manually.
-					queue[t] = now
+			if s.slotFree(t, nil) {
+				if s.startTorrent(t) != nil { // problem starting? unable to report error. queue it manually.
+					s.queue[t] = now
 				}
 			} else {
-				queue[t] = now
+				s.queue[t] = now
 			}
 		default:
 		}
 	}
-	pause = nil
 }
 
 func Paused() bool {
-	mu.Lock()
-	defer mu.Unlock()
-	return pause != nil
+	return defaultSession.Paused()
+}
+
+func (s *Session) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pause != nil
 }
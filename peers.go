@@ -11,6 +11,9 @@ type Peer struct {
 	// how many data we downloaded/uploaded from peer
 	Downloaded int64
 	Uploaded   int64
+	// bytes per second, 5 seconds average
+	DownloadRate int64
+	UploadRate   int64
 }
 
 const (
@@ -23,11 +26,18 @@ const (
 )
 
 func TorrentPeersCount(i int) int {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.TorrentPeersCount(i)
+}
+
+func (s *Session) TorrentPeersCount(i int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	t := torrents[i]
-	f := filestorage[t.InfoHash()]
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
+	f := s.filestorage[t.InfoHash()]
 
 	f.Peers = nil
 
@@ -45,17 +55,25 @@ func TorrentPeersCount(i int) int {
 		case peerSourceLPD:
 			p = "LPD"
 		}
-		f.Peers = append(f.Peers, Peer{v.Id, v.Name, v.Addr, p, v.SupportsEncryption, v.PiecesCompleted, v.Downloaded, v.Uploaded})
+		r := s.peerRates(t, v.Addr, RateWindowMedium)
+		f.Peers = append(f.Peers, Peer{v.Id, v.Name, v.Addr, p, v.SupportsEncryption, v.PiecesCompleted, v.Downloaded, v.Uploaded, int64(r.Download), int64(r.Upload)})
 	}
 
 	return len(f.Peers) // t.PeersCount()
 }
 
 func TorrentPeers(i int, p int) *Peer {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.TorrentPeers(i, p)
+}
+
+func (s *Session) TorrentPeers(i int, p int) *Peer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	t := torrents[i]
-	f := filestorage[t.InfoHash()]
+	t, err := s.lookup(i)
+	if err != nil {
+		return nil
+	}
+	f := s.filestorage[t.InfoHash()]
 	return &f.Peers[p]
 }
@@ -10,25 +10,46 @@ const (
 )
 
 func TorrentPieceLength(i int) int64 {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
+	return defaultSession.TorrentPieceLength(i)
+}
+
+func (s *Session) TorrentPieceLength(i int) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
 	return t.Info().PieceLength
 }
 
 func TorrentPiecesCount(i int) int {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
+	return defaultSession.TorrentPiecesCount(i)
+}
+
+func (s *Session) TorrentPiecesCount(i int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
 	return t.NumPieces()
 }
 
 func TorrentPiecesCompactCount(i int, size int) int {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.TorrentPiecesCompactCount(i, size)
+}
+
+func (s *Session) TorrentPiecesCompactCount(i int, size int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	t := torrents[i]
-	fs := filestorage[t.InfoHash()]
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
+	fs := s.filestorage[t.InfoHash()]
 	fs.Pieces = nil
 
 	pended := false
@@ -94,9 +115,16 @@ func TorrentPiecesCompactCount(i int, size int) int {
 }
 
 func TorrentPiecesCompact(i int, p int) int32 {
-	mu.Lock()
-	defer mu.Unlock()
-	t := torrents[i]
-	f := filestorage[t.InfoHash()]
+	return defaultSession.TorrentPiecesCompact(i, p)
+}
+
+func (s *Session) TorrentPiecesCompact(i int, p int) int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
+	f := s.filestorage[t.InfoHash()]
 	return f.Pieces[p]
 }
@@ -10,18 +10,10 @@ import (
 	"strconv"
 	"time"
 
-	"github.com/anacrolix/missinggo"
 	"github.com/syncthing/syncthing/lib/nat"
 	"github.com/syncthing/syncthing/lib/upnp"
 )
 
-var tcpPort string
-var udpPort string
-var mappingAddr []string // clientAddr when mapping called
-var clientPorts []string
-
-var mappingClose missinggo.Event
-
 var (
 	RefreshPort = (1 * time.Minute).Nanoseconds()
 )
@@ -67,24 +59,28 @@ func localIP(gip net.IP) (ips []string) {
 }
 
 func PortCount() int {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.PortCount()
+}
 
-	clientPorts = portList()
+func (s *Session) PortCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	return len(clientPorts)
+	s.clientPorts = s.portList()
+
+	return len(s.clientPorts)
 }
 
-func portList() []string {
+func (s *Session) portList() []string {
 	var ports []string
 
-	if udpPort != "" { // tcpPort the same
-		ports = append(ports, udpPort)
+	if s.udpPort != "" { // tcpPort the same
+		ports = append(ports, s.udpPort)
 	}
 
-	host, port, err := net.SplitHostPort(clientAddr)
+	host, port, err := net.SplitHostPort(s.clientAddr)
 	if err != nil {
-		ports = append(ports, clientAddr)
+		ports = append(ports, s.clientAddr)
 	} else {
 		if host == "" || host == "::" {
 			ips := localIP(nil)
@@ -103,18 +99,31 @@ func portList() []string {
 }
 
 func Port(i int) string {
-	mu.Lock()
-	defer mu.Unlock()
-	return clientPorts[i]
+	return defaultSession.Port(i)
+}
+
+func (s *Session) Port(i int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clientPorts[i]
 }
 
 func PortCheck() (bool, error) {
-	port := tcpPort
+	return defaultSession.PortCheck()
+}
+
+func (s *Session) PortCheck() (bool, error) {
+	var err error
+
+	s.mu.Lock()
+	port := s.tcpPort
 	if port == "" { // check does not perfome on UDP but what we can do?
-		port = udpPort
+		port = s.udpPort
 	}
+	addr := s.clientAddr
+	s.mu.Unlock()
 	if port == "" { // ports are not forwarded? using local socket port
-		_, port, err = net.SplitHostPort(clientAddr)
+		_, port, err = net.SplitHostPort(addr)
 		if err != nil {
 			return false, err
 		}
@@ -135,24 +144,24 @@ func PortCheck() (bool, error) {
 
 	buf := new(bytes.Buffer)
 	buf.ReadFrom(resp.Body)
-	s := buf.String()
+	str := buf.String()
 
-	if s == "1" {
+	if str == "1" {
 		return true, nil
 	}
-	if s == "0" {
+	if str == "0" {
 		return false, nil
 	}
 
 	return false, errors.New("unable to get resposne")
 }
 
-func getPort(d nat.Device, proto nat.Protocol, port int, extPort string) (int, error) {
+func (s *Session) getPort(d nat.Device, proto nat.Protocol, port int, extPort string) (int, error) {
 	var n string
-	if clientConfig.Bep20 == "" {
+	if s.clientConfig.Bep20 == "" {
 		n = "libtorrent"
 	} else {
-		n = clientConfig.Bep20
+		n = s.clientConfig.Bep20
 	}
 
 	_, ep, err := net.SplitHostPort(extPort)
@@ -165,7 +174,7 @@ func getPort(d nat.Device, proto nat.Protocol, port int, extPort string) (int, e
 		ext = port
 	}
 
-	lease := 2 * time.Duration(RefreshPort) * time.Nanosecond
+	lease := 2 * time.Duration(s.cfg.RefreshPort) * time.Nanosecond
 
 	// try specific port
 	p, err := d.AddPortMapping(proto, port, ext, n, lease)
@@ -193,10 +202,10 @@ func getPort(d nat.Device, proto nat.Protocol, port int, extPort string) (int, e
 	return 0, err
 }
 
-func mappingPort(timeout time.Duration) error {
-	mu.Lock()
-	_, pp, err := net.SplitHostPort(clientAddr)
-	mu.Unlock()
+func (s *Session) mappingPort(timeout time.Duration) error {
+	s.mu.Lock()
+	_, pp, err := net.SplitHostPort(s.clientAddr)
+	s.mu.Unlock()
 	if err != nil {
 		return err
 	}
@@ -213,19 +222,19 @@ func mappingPort(timeout time.Duration) error {
 		if err != nil {
 			return err
 		}
-		mu.Lock()
-		pp := udpPort // reuse old port
+		s.mu.Lock()
+		pp := s.udpPort // reuse old port
 		if pp == "" {
-			pp = tcpPort // reuse tcp port
+			pp = s.tcpPort // reuse tcp port
 		}
-		mu.Unlock()
-		p, err := getPort(d, nat.UDP, localport, pp)
+		s.mu.Unlock()
+		p, err := s.getPort(d, nat.UDP, localport, pp)
 		if err != nil {
 			return err
 		}
-		mu.Lock()
-		defer mu.Unlock()
-		udpPort = net.JoinHostPort(ext.String(), strconv.Itoa(p))
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.udpPort = net.JoinHostPort(ext.String(), strconv.Itoa(p))
 		return nil
 	}
 	udp := u
@@ -235,19 +244,19 @@ func mappingPort(timeout time.Duration) error {
 		if err != nil {
 			return err
 		}
-		mu.Lock()
-		pp := tcpPort // reuse old port
+		s.mu.Lock()
+		pp := s.tcpPort // reuse old port
 		if pp == "" {
-			pp = udpPort // reuse udp port
+			pp = s.udpPort // reuse udp port
 		}
-		mu.Unlock()
-		p, err := getPort(d, nat.TCP, localport, pp)
+		s.mu.Unlock()
+		p, err := s.getPort(d, nat.TCP, localport, pp)
 		if err != nil {
 			return err
 		}
-		mu.Lock()
-		defer mu.Unlock()
-		tcpPort = net.JoinHostPort(ext.String(), strconv.Itoa(p))
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.tcpPort = net.JoinHostPort(ext.String(), strconv.Itoa(p))
 		return nil
 	}
 	tcp := t
@@ -267,14 +276,14 @@ func mappingPort(timeout time.Duration) error {
 	}
 
 	// start tcp priority
-	mu.Lock()
-	if udpPort != tcpPort { // ooops...
-		if tcpPort != "" { // tcp assigned, so UPnP/NAP-PMP working.
+	s.mu.Lock()
+	if s.udpPort != s.tcpPort { // ooops...
+		if s.tcpPort != "" { // tcp assigned, so UPnP/NAP-PMP working.
 			// did we miss udp port or tcp is different? which menas we unable to get tcp port number same as udp port.
 			// we need to reset udp port and try assign udp port number same as tcp port.
-			if udpPort != "" { // udp assgined so UPnP/NAP-PMP udp working.
-				udpPort = ""
-				mu.Unlock()
+			if s.udpPort != "" { // udp assgined so UPnP/NAP-PMP udp working.
+				s.udpPort = ""
+				s.mu.Unlock()
 				udp = u
 				for _, d := range dd {
 					if udp != nil {
@@ -283,56 +292,56 @@ func mappingPort(timeout time.Duration) error {
 						}
 					}
 				}
-				mu.Lock()
-				if udpPort == "" { // unable to assign udp port reset booth
-					udpPort = ""
-					tcpPort = ""
+				s.mu.Lock()
+				if s.udpPort == "" { // unable to assign udp port reset booth
+					s.udpPort = ""
+					s.tcpPort = ""
 				}
 			}
 		}
 	}
-	mu.Unlock()
+	s.mu.Unlock()
 
-	mu.Lock()
-	defer mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	if tcp != nil {
-		tcpPort = ""
+		s.tcpPort = ""
 	}
 
 	if udp != nil {
-		udpPort = ""
+		s.udpPort = ""
 	}
 
 	// udp have priority we are using uTP
-	if udpPort == "" || tcpPort == "" { // udp == tcp == ""
-		udpPort = "" // just to be sure
-		tcpPort = ""
-		updateClientAddr("")
+	if s.udpPort == "" || s.tcpPort == "" { // udp == tcp == ""
+		s.udpPort = "" // just to be sure
+		s.tcpPort = ""
+		s.updateClientAddr("")
 		return nil
 	}
 
-	if tcpPort != udpPort {
-		tcpPort = "" // if we got different TCP port, reset it
-		updateClientAddr(udpPort)
+	if s.tcpPort != s.udpPort {
+		s.tcpPort = "" // if we got different TCP port, reset it
+		s.updateClientAddr(s.udpPort)
 		return nil
 	}
 
-	if tcpPort == udpPort { // finnely!
-		updateClientAddr(udpPort)
+	if s.tcpPort == s.udpPort { // finnely!
+		s.updateClientAddr(s.udpPort)
 		return nil
 	}
 
 	return nil // never here
 }
 
-func updateClientAddr(addr string) {
-	if client == nil { // already closed
+func (s *Session) updateClientAddr(addr string) {
+	if s.client == nil { // already closed
 		return
 	}
 	p := 0
 	if addr != "" {
-		_, port, err := net.SplitHostPort(clientAddr)
+		_, port, err := net.SplitHostPort(s.clientAddr)
 		if err != nil {
 			panic(err)
 		}
@@ -341,51 +350,51 @@ func updateClientAddr(addr string) {
 			panic(err)
 		}
 	}
-	client.Config(func() { clientConfig.PublicIp4Port = p })
+	s.client.Config(func() { s.clientConfig.PublicIp4Port = p })
 }
 
-func mappingStart() {
-	mu.Lock()
-	mappingClose.Set()
-	mappingClose.Clear()
-	mu.Unlock()
+func (s *Session) mappingStart() {
+	s.mu.Lock()
+	s.mappingClose.Set()
+	s.mappingClose.Clear()
+	s.mu.Unlock()
 
-	refresh := RefreshPort
+	refresh := s.cfg.RefreshPort
 
-	if udpPort == "" { // start from 1 second if previous mapping failed
+	if s.udpPort == "" { // start from 1 second if previous mapping failed
 		refresh = (1 * time.Second).Nanoseconds()
 	}
 
 	for {
-		mu.Lock()
-		if client == nil { // client can be closed already
-			mu.Unlock()
+		s.mu.Lock()
+		if s.client == nil { // client can be closed already
+			s.mu.Unlock()
 			return
 		}
-		clientClose := client.Wait()
-		mu.Unlock()
+		clientClose := s.client.Wait()
+		s.mu.Unlock()
 		select {
-		case <-mappingClose.LockedChan(&mu):
+		case <-s.mappingClose.LockedChan(&s.mu):
 			return
 		case <-clientClose:
 			return
 		case <-time.After(time.Duration(refresh) * time.Nanosecond):
 		}
 		// in go routine do 1 seconds discovery
-		mappingPort(1 * time.Second)
-		if udpPort != "" { // on success, normal refresh rate
-			refresh = RefreshPort
+		s.mappingPort(1 * time.Second)
+		if s.udpPort != "" { // on success, normal refresh rate
+			refresh = s.cfg.RefreshPort
 		} else {
 			refresh = refresh * 2
 		}
-		if refresh > RefreshPort {
-			refresh = RefreshPort
+		if refresh > s.cfg.RefreshPort {
+			refresh = s.cfg.RefreshPort
 		}
 	}
 }
 
-func mappingStop() {
-	mappingClose.Set()
-	mappingAddr = nil
-	updateClientAddr("")
+func (s *Session) mappingStop() {
+	s.mappingClose.Set()
+	s.mappingAddr = nil
+	s.updateClientAddr("")
 }
@@ -0,0 +1,163 @@
+package libtorrent
+
+import (
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// file priorities, each downloaded with own piece priority: Low - normal,
+// Normal - high, High - readahead, Maximum - next. piece 'now' left to
+// streaming.
+const (
+	FilePrioritySkip    int32 = 0 // same as unchecked file
+	FilePriorityLow     int32 = 1
+	FilePriorityNormal  int32 = 2
+	FilePriorityHigh    int32 = 3
+	FilePriorityMaximum int32 = 4
+)
+
+// TorrentFilesPriority
+//
+// Set file 'p' download priority, FilePriority* constant. FilePrioritySkip
+// unchecks file, any other value checks it.
+//
+//export TorrentFilesPriority
+func TorrentFilesPriority(i int, p int, prio int32) bool {
+	return defaultSession.TorrentFilesPriority(i, p, prio)
+}
+
+func (s *Session) TorrentFilesPriority(i int, p int, prio int32) bool {
+	err := s.TorrentFilesPriorityE(i, p, prio)
+	s.setError(err)
+	return err == nil
+}
+
+func TorrentFilesPriorityE(i int, p int, prio int32) error {
+	return defaultSession.TorrentFilesPriorityE(i, p, prio)
+}
+
+func (s *Session) TorrentFilesPriorityE(i int, p int, prio int32) error {
+	if prio < FilePrioritySkip || prio > FilePriorityMaximum {
+		return ErrPriority
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return err
+	}
+	if t.Info() == nil {
+		return ErrNoMetadata
+	}
+
+	fs := s.filestorage[t.InfoHash()]
+
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[t.InfoHash()]
+	if p < 0 || p >= len(ts.checks) {
+		s.torrentstorageLock.Unlock()
+		return ErrUnknownFile
+	}
+	if ts.priorities == nil {
+		ts.priorities = make([]int32, len(ts.checks))
+	}
+	ts.checks[p] = prio != FilePrioritySkip
+	if prio != FilePrioritySkip { // keep level for unchecked files
+		ts.priorities[p] = prio
+	}
+	s.torrentstorageLock.Unlock()
+
+	// update dynamic data
+	if p < len(fs.Files) {
+		ff := &fs.Files[p]
+		ff.Check = prio != FilePrioritySkip
+		ff.Priority = prio
+	}
+
+	s.fileUpdateCheck(t)
+
+	return nil
+}
+
+// pieces which should be raised above Low priority, piece gets highest
+// priority of files it belongs to.
+func filePiecePriorities(info *metainfo.Info, priorities []int32) map[int]int32 {
+	pp := make(map[int]int32)
+
+	var offset int64
+	for i, fi := range info.UpvertedFiles() {
+		s := offset / info.PieceLength
+		e := (offset + fi.Length) / info.PieceLength
+		r := (offset + fi.Length) % info.PieceLength
+		if r > 0 {
+			e++
+		}
+		offset += fi.Length
+		if priorities[i] <= FilePriorityLow {
+			continue
+		}
+		for k := int(s); k < int(e); k++ {
+			if pp[k] < priorities[i] {
+				pp[k] = priorities[i]
+			}
+		}
+	}
+
+	return pp
+}
+
+// raise pending pieces priorities by file priorities. call after pieces been
+// pended by DownloadPieces().
+func (s *Session) filePriorityUpdate(t *torrent.Torrent) {
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[t.InfoHash()]
+	pp := filePiecePriorities(ts.info, ts.Priorities())
+	s.torrentstorageLock.Unlock()
+
+	for piece, prio := range pp {
+		setPiecePriority(t, piece, filePieceLevel(prio))
+	}
+}
+
+// library piece priorities, same order as torrent.PiecePriority*
+const (
+	pieceNone = iota
+	pieceNormal
+	pieceHigh
+	pieceReadahead
+	pieceNext
+	pieceNow
+)
+
+// piece level for pending piece with given FilePriority*
+func filePieceLevel(prio int32) int {
+	switch prio {
+	case FilePriorityNormal:
+		return pieceHigh
+	case FilePriorityHigh:
+		return pieceReadahead
+	case FilePriorityMaximum:
+		return pieceNext
+	}
+	return pieceNormal
+}
+
+func setPiecePriority(t *torrent.Torrent, piece int, level int) {
+	p := t.Piece(piece)
+	switch level {
+	case pieceNone:
+		p.SetPriority(torrent.PiecePriorityNone)
+	case pieceNormal:
+		p.SetPriority(torrent.PiecePriorityNormal)
+	case pieceHigh:
+		p.SetPriority(torrent.PiecePriorityHigh)
+	case pieceReadahead:
+		p.SetPriority(torrent.PiecePriorityReadahead)
+	case pieceNext:
+		p.SetPriority(torrent.PiecePriorityNext)
+	case pieceNow:
+		p.SetPriority(torrent.PiecePriorityNow)
+	}
+}
@@ -0,0 +1,93 @@
+package libtorrent
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestFilePiecePriorities(t *testing.T) {
+	info := &metainfo.Info{
+		PieceLength: 10,
+		Files: []metainfo.FileInfo{
+			{Length: 15, Path: []string{"a"}}, // pieces 0, 1
+			{Length: 10, Path: []string{"b"}}, // pieces 1, 2
+			{Length: 5, Path: []string{"c"}},  // piece 2
+		},
+	}
+
+	pp := filePiecePriorities(info, []int32{FilePriorityHigh, FilePriorityNormal, FilePriorityMaximum})
+	if len(pp) != 3 || pp[0] != FilePriorityHigh || pp[1] != FilePriorityHigh || pp[2] != FilePriorityMaximum {
+		t.Error(pp)
+	}
+
+	pp = filePiecePriorities(info, []int32{FilePriorityLow, FilePrioritySkip, FilePriorityNormal})
+	if len(pp) != 1 || pp[2] != FilePriorityNormal {
+		t.Error(pp)
+	}
+
+	pp = filePiecePriorities(info, []int32{FilePriorityLow, FilePrioritySkip, FilePriorityLow})
+	if len(pp) != 0 {
+		t.Error(pp)
+	}
+}
+
+// library requests pieces with higher priority first
+func TestFilePriorityPieces(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libtorrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := NewConfig()
+	cfg.BindAddr = ":0"
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	pp := []int32{FilePriorityLow, FilePriorityNormal, FilePriorityHigh, FilePriorityMaximum}
+	info := metainfo.Info{Name: "a", PieceLength: 16 * 1024, Pieces: make([]byte, 20*len(pp))}
+	for k := range pp {
+		info.Files = append(info.Files, metainfo.FileInfo{Length: info.PieceLength, Path: []string{strconv.Itoa(k)}})
+	}
+	ib, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = (&metainfo.MetaInfo{InfoBytes: ib}).Write(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := s.AddTorrentFromBytesE(dir, buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p, prio := range pp {
+		err = s.TorrentFilesPriorityE(i, p, prio)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.mu.Lock()
+	tt := s.torrents[i]
+	s.mu.Unlock()
+	for k := 1; k < len(pp); k++ { // file per piece
+		if a, b := tt.PieceState(k-1).Priority, tt.PieceState(k).Priority; a >= b {
+			t.Error(k, a, b)
+		}
+	}
+	if p := tt.PieceState(0).Priority; p != torrent.PiecePriorityNormal {
+		t.Error(p)
+	}
+}
@@ -7,228 +7,275 @@ import (
 	"github.com/anacrolix/torrent"
 )
 
-var ActiveCount = 3
+var ActiveCount = 3     // overall active torrents, see Config.ActiveTotal
+var ActiveDownloads = 0 // 0 - limited by ActiveCount only
+var ActiveSeeds = 0     // 0 - limited by ActiveCount only
 var QueueTimeout = (30 * time.Minute).Nanoseconds()
 
-var queue map[*torrent.Torrent]int64
-
-type Int64Slice []int64
-
-func (p Int64Slice) Len() int           { return len(p) }
-func (p Int64Slice) Less(i, j int) bool { return p[i] < p[j] }
-func (p Int64Slice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
-func (p Int64Slice) Sort()              { sort.Sort(p) }
-
 // priority start torrent. downloading torrent goes first, seeding second.
-func queueStart(t *torrent.Torrent) bool {
-	delete(queue, t)
+func (s *Session) queueStart(t *torrent.Torrent) error {
+	delete(s.queue, t)
 
-	if len(active) < ActiveCount {
-		return startTorrent(t)
+	if s.slotFree(t, nil) {
+		return s.startTorrent(t)
 	}
 
-	// build active torrent array with activate time
-	q := make(map[int64]*torrent.Torrent)
-	var l []int64
-	for _, m := range torrents {
+	// build active torrent array with activate time, older first
+	var l []*torrent.Torrent
+	for m := range s.active {
 		if m == t {
 			continue
 		}
-		if _, ok := active[m]; ok {
-			fs := filestorage[m.InfoHash()]
-			v := fs.ActivateDate
-			q[v] = m
-			l = append(l, v)
+		if !s.slotUsed(m) { // forced and slow torrents do not hold slots
+			continue
 		}
+		l = append(l, m)
 	}
-	sort.Sort(Int64Slice(l)) // older torrent will be removed first
+	sort.Slice(l, func(i, j int) bool {
+		return s.filestorage[l[i].InfoHash()].ActivateDate < s.filestorage[l[j].InfoHash()].ActivateDate
+	})
 
 	now := time.Now().UnixNano()
 
-	if !pendingCompleted(t) { // t is downloading
-		// try to find seeding torrent
-		for _, v := range l {
-			m := q[v]
-			// m is seeding?
-			if pendingCompleted(m) {
-				stopTorrent(m)
-				queue[m] = now
-				return startTorrent(t)
-			}
+	var seeding, downloading []*torrent.Torrent
+	for _, m := range l {
+		if s.pendingCompleted(m) {
+			seeding = append(seeding, m)
+		} else {
+			downloading = append(downloading, m)
 		}
-		// ok all torrents are downloading, remove first downloading torrent
-		for _, v := range l {
-			m := q[v]
-			stopTorrent(m)
-			queue[m] = now
-			return startTorrent(t)
+	}
+
+	// pick torrent to replace with. same class if class limit reached, otherwise
+	// seeding torrents goes first.
+	var candidates []*torrent.Torrent
+	if !s.pendingCompleted(t) { // t is downloading
+		if s.cfg.ActiveDownloads > 0 && len(downloading) >= s.cfg.ActiveDownloads {
+			candidates = downloading
+		} else {
+			candidates = append(seeding, downloading...)
 		}
 	} else { // t is seeding
-		// try to find first seeding torrent to replace with
-		for _, v := range l {
-			m := q[v]
-			if pendingCompleted(m) { // seeding
-				stopTorrent(m)
-				queue[m] = now
-				return startTorrent(t)
-			}
+		if s.cfg.ActiveSeeds > 0 && len(seeding) >= s.cfg.ActiveSeeds {
+			candidates = seeding
+		} else {
+			// if 't' seeding downloading will be resumed after 't' removed by timeout.
+			candidates = append(seeding, downloading...)
 		}
 	}
 
-	// seems like t seeding, and have no slots, just queue and downloading.
+	for _, m := range candidates {
+		if !s.slotFree(t, m) {
+			continue
+		}
+		s.stopTorrent(m)
+		s.queue[m] = now
+		return s.startTorrent(t)
+	}
+
+	// no slots, just queue
+	s.stopTorrent(t)
+	s.queue[t] = now
+	return nil
+}
 
-	// try to find first active torrent to replace with. if 't' seeding downloading will be resumed after 't' removed by timeout.
-	for _, v := range l {
-		m := q[v]
-		stopTorrent(m)
-		queue[m] = now
-		return startTorrent(t)
+// torrent is holding active slot
+func (s *Session) slotUsed(t *torrent.Torrent) bool {
+	if _, ok := s.active[t]; !ok {
+		return false
+	}
+	if s.forced[t] {
+		return false
 	}
+	return !s.torrentSlow(t)
+}
+
+// slow torrents (below Slow*Rate over SlowWindow) do not hold slots
+func (s *Session) torrentSlow(t *torrent.Torrent) bool {
+	seeding := s.pendingCompleted(t)
+	limit := s.cfg.SlowDownloadRate
+	if seeding {
+		limit = s.cfg.SlowUploadRate
+	}
+	if limit <= 0 {
+		return false
+	}
+	fs := s.filestorage[t.InfoHash()]
+	if time.Now().UnixNano()-fs.ActivateDate < s.cfg.SlowWindow { // give time to start
+		return false
+	}
+	r := s.torrentRates(t, s.cfg.SlowWindow)
+	if seeding {
+		return r.Upload < limit
+	}
+	return r.Download < limit
+}
+
+// is here slot available for 't', do not count 'except' torrent
+func (s *Session) slotFree(t *torrent.Torrent, except *torrent.Torrent) bool {
+	seeds := 0
+	downloads := 0
+	for m := range s.active {
+		if m == t || m == except {
+			continue
+		}
+		if !s.slotUsed(m) {
+			continue
+		}
+		if s.pendingCompleted(m) {
+			seeds++
+		} else {
+			downloads++
+		}
+	}
+	if s.cfg.ActiveTotal > 0 && seeds+downloads >= s.cfg.ActiveTotal {
+		return false
+	}
+	if s.pendingCompleted(t) {
+		return s.cfg.ActiveSeeds == 0 || seeds < s.cfg.ActiveSeeds
+	}
+	return s.cfg.ActiveDownloads == 0 || downloads < s.cfg.ActiveDownloads
+}
 
-	// normally should never be here.
-	stopTorrent(t)
-	queue[t] = now
-	return true
+// start queued torrents while slots are available
+func (s *Session) queueFill() {
+	if s.pause != nil { // Resume() will start queued torrents
+		return
+	}
+	for s.queueNext(nil) {
+	}
 }
 
-func queueEngine(t *torrent.Torrent) {
-	timeout := time.Duration(QueueTimeout) * time.Nanosecond
+func (s *Session) queueEngine(t *torrent.Torrent) {
+	s.mu.Lock()
+	timeout := time.Duration(s.cfg.QueueTimeout) * time.Nanosecond
+	s.mu.Unlock()
 	for {
 		b1 := t.BytesCompleted()
 		// in case if user set file to download on the same torrent, we need to receive Completed again.
-		torrentstorageLock.Lock()
-		ts := torrentstorage[t.InfoHash()]
+		s.torrentstorageLock.Lock()
+		ts := s.torrentstorage[t.InfoHash()]
 		ts.next.Clear()
-		torrentstorageLock.Unlock()
+		s.torrentstorageLock.Unlock()
 		select {
 		case <-time.After(timeout):
-		case <-ts.next.LockedChan(&mu):
-			mu.Lock()
-			fs := filestorage[t.InfoHash()]
+		case <-ts.next.LockedChan(&s.mu):
+			s.mu.Lock()
+			fs := s.filestorage[t.InfoHash()]
 			// we will be first who knows torrent is complete, and moved from active (downloading) state.
 			if fs.CompletedDate == 0 {
 				now := time.Now().UnixNano()
 				fs.CompletedDate = now
 				fs.DownloadingTime = fs.DownloadingTime + (now - fs.ActivateDate)
 				fs.ActivateDate = now // seeding time now
+				s.eventCompleted(t)
 			}
-			webSeedStop(t)
-			mu.Unlock()
+			s.webSeedStop(t)
+			s.eventStatus()
+			s.mu.Unlock()
 		case <-t.Wait():
-			mu.Lock()
-			if _, ok := active[t]; !ok { // torrent done exit
-				mu.Unlock()
+			s.mu.Lock()
+			if _, ok := s.active[t]; !ok { // torrent done exit
+				s.mu.Unlock()
 				return
 			} // else torrent been stopped by 'torrent' library. checking? then we have to restart queueEngine
-			mu.Unlock()
+			s.mu.Unlock()
 			continue // restart queueEngine
 		}
-		timeout = time.Duration(QueueTimeout) * time.Nanosecond
-		mu.Lock()
-		if _, ok := active[t]; !ok { // engine should be running for active torrents only (two queueEngine on same torrent?)
-			mu.Unlock()
+		s.mu.Lock()
+		timeout = time.Duration(s.cfg.QueueTimeout) * time.Nanosecond
+		if _, ok := s.active[t]; !ok { // engine should be running for active torrents only (two queueEngine on same torrent?)
+			s.mu.Unlock()
 			return // we sholuld not call queueNext on suspend torrent, otherwise it overlap ActiveTorrent
 		}
-		if pendingCompleted(t) { // seeding
-			if queueNext(t) { // we been removed, stop queue engine
-				mu.Unlock()
+		forced := s.forced[t]      // forced torrents are not rotated
+		if s.pendingCompleted(t) { // seeding, seed goals checked by seedUpdate()
+			if forced {
+				// keep seeding
+			} else if s.queueNext(t) { // we been removed, stop queue engine
+				s.mu.Unlock()
 				return
 			} else { // we not been removed
-				if len(queue) != 0 {
+				if len(s.queue) != 0 {
 					// queue full, some one soon be available, check every minute
 					timeout = 1 * time.Minute
 				}
 			}
 		} else { // downloading
 			b2 := t.BytesCompleted()
-			if b1 == b2 { // check stalled, and rotate if it does
-				if queueNext(t) { // we been removed, stop queue engine
-					mu.Unlock()
+			if b1 == b2 && !forced { // check stalled, and rotate if it does
+				if s.queueNext(t) { // we been removed, stop queue engine
+					s.mu.Unlock()
 					return
 				} else { // we not been removed
-					if len(queue) != 0 {
+					if len(s.queue) != 0 {
 						// queue full, some one soon be available, check every minute
 						timeout = 1 * time.Minute
 					}
 				}
 			}
 		}
-		mu.Unlock()
+		s.mu.Unlock()
 	}
 }
 
 // 30 min seeding, download complete, 30 min stole torrent.
-func queueNext(t *torrent.Torrent) bool {
+func (s *Session) queueNext(t *torrent.Torrent) bool {
 	now := time.Now().UnixNano()
 
-	// build active torrent array with activate time
-	q := make(map[int64]*torrent.Torrent)
-	var l []int64
-	for m, v := range queue {
+	// build queued torrent array in queue order
+	var l []*torrent.Torrent
+	for _, m := range s.queueOrder() {
+		v, ok := s.queue[m]
+		if !ok {
+			continue
+		}
 		// queue all || keep torrent resting for 30 mins
-		if len(active) < ActiveCount || v+QueueTimeout <= now {
-			q[v] = m
-			l = append(l, v)
+		if s.slotFree(m, nil) || (t != nil && v+s.cfg.QueueTimeout <= now && s.slotFree(m, t)) {
+			l = append(l, m)
+		}
+	}
+
+	start := func(m *torrent.Torrent) bool {
+		err := s.startTorrent(m)
+		if err != nil {
+			s.eventError(m, err) // unable to start torrent, keep looping.
+			return false
+		}
+		delete(s.queue, m)
+		if t != nil {
+			s.stopTorrent(t)
+			s.queue[t] = now
 		}
+		s.eventStatus()
+		return true
 	}
-	sort.Sort(Int64Slice(l)) // older first
 
 	// check for downloading queue torrents
-	for _, v := range l {
-		m := q[v]
-		if !pendingCompleted(m) {
-			if startTorrent(m) {
-				delete(queue, m)
-				if t != nil {
-					stopTorrent(t)
-					queue[t] = now
-				}
-				return true
-			}
-			// unable to start torrent, here no place to report an error. keep looping.
+	for _, m := range l {
+		if !s.pendingCompleted(m) && start(m) {
+			return true
 		}
 	}
 
 	// check for seeding queue
-	for _, v := range l {
-		m := q[v]
-		if pendingCompleted(m) {
-			if startTorrent(m) {
-				delete(queue, m)
-				if t != nil {
-					stopTorrent(t)
-					queue[t] = now
-				}
-				return true
-			}
-			// unable to start torrent, here no place to report an error. keep looping.
+	for _, m := range l {
+		if s.pendingCompleted(m) && start(m) {
+			return true
 		}
 	}
 
 	if t != nil {
 		// is 't' seeding torrent? if here any downloading, queue it, regardless on timeout
-		if pendingCompleted(t) {
-			// load all torrents, we will take most oldest added to the queue
-			q := make(map[int64]*torrent.Torrent)
-			var l []int64
-			// add all from queue
-			for m, v := range queue {
-				q[v] = m
-				l = append(l, v)
-			}
-			sort.Sort(Int64Slice(l)) // older first
-
-			for _, v := range l {
-				m := q[v]
+		if s.pendingCompleted(t) {
+			// load all queued torrents, we will take first by queue order
+			for _, m := range s.queueOrder() {
+				if _, ok := s.queue[m]; !ok {
+					continue
+				}
 				// m - downloading in queue?
-				if !pendingCompleted(m) {
-					if startTorrent(m) {
-						delete(queue, m)
-						stopTorrent(t)
-						queue[t] = now
-						return true
-					}
-					// unable to start torrent, here no place to report an error. keep looping.
+				if !s.pendingCompleted(m) && s.slotFree(m, t) && start(m) {
+					return true
 				}
 			}
 		}
@@ -237,3 +284,216 @@ func queueNext(t *torrent.Torrent) bool {
 	// queue is empty, change nothing
 	return false
 }
+
+// ForceStartTorrent
+//
+// Start torrent regardless ActiveCount limit. Forced torrent does not take
+// queue slot and never rotated by queue engine. StartTorrent() / StopTorrent()
+// clears force flag.
+//
+//export ForceStartTorrent
+func ForceStartTorrent(i int) bool {
+	return defaultSession.ForceStartTorrent(i)
+}
+
+func (s *Session) ForceStartTorrent(i int) bool {
+	err := s.ForceStartTorrentE(i)
+	s.setError(err)
+	return err == nil
+}
+
+func ForceStartTorrentE(i int) error {
+	return defaultSession.ForceStartTorrentE(i)
+}
+
+func (s *Session) ForceStartTorrentE(i int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer s.eventStatus()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return err
+	}
+
+	if s.pause != nil {
+		s.pause[t] = StatusForced
+		return nil
+	}
+
+	delete(s.queue, t)
+
+	s.forced[t] = true
+
+	if _, ok := s.active[t]; ok {
+		return nil
+	}
+
+	err = s.startTorrent(t)
+	if err != nil {
+		delete(s.forced, t)
+		return err
+	}
+	return nil
+}
+
+// all torrents sorted by queue position
+func (s *Session) queueOrder() []*torrent.Torrent {
+	var ii []int
+	for i := range s.torrents {
+		ii = append(ii, i)
+	}
+	sort.Slice(ii, func(a, b int) bool {
+		fa := s.filestorage[s.torrents[ii[a]].InfoHash()]
+		fb := s.filestorage[s.torrents[ii[b]].InfoHash()]
+		if fa.QueuePosition == fb.QueuePosition {
+			return ii[a] < ii[b]
+		}
+		return fa.QueuePosition < fb.QueuePosition
+	})
+	var l []*torrent.Torrent
+	for _, i := range ii {
+		l = append(l, s.torrents[i])
+	}
+	return l
+}
+
+// renumber positions to follow 'l' order, starting from 1 (0 - not set).
+// moved torrents saved on next autosave.
+func (s *Session) queueRenumber(l []*torrent.Torrent) {
+	for i, t := range l {
+		fs := s.filestorage[t.InfoHash()]
+		if fs.QueuePosition != int64(i+1) {
+			fs.QueuePosition = int64(i + 1)
+			s.stateChanged(t)
+		}
+	}
+}
+
+// move torrent 'i' to position 'p' (clamped)
+func (s *Session) queueMove(i int, p func(old int, n int) int) error {
+	t, err := s.lookup(i)
+	if err != nil {
+		return err
+	}
+	l := s.queueOrder()
+	old := 0
+	for k, m := range l {
+		if m == t {
+			old = k
+			break
+		}
+	}
+	n := p(old, len(l))
+	if n < 0 {
+		n = 0
+	}
+	if n >= len(l) {
+		n = len(l) - 1
+	}
+	l = append(l[:old], l[old+1:]...)
+	l = append(l[:n], append([]*torrent.Torrent{t}, l[n:]...)...)
+	s.queueRenumber(l)
+	return nil
+}
+
+// QueuePosition
+//
+// Torrent position in queue, 0 - first to start.
+//
+//export QueuePosition
+func QueuePosition(i int) int {
+	return defaultSession.QueuePosition(i)
+}
+
+func (s *Session) QueuePosition(i int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
+	for k, m := range s.queueOrder() {
+		if m == t {
+			return k
+		}
+	}
+	return -1
+}
+
+//export QueueMoveUp
+func QueueMoveUp(i int) {
+	defaultSession.QueueMoveUp(i)
+}
+
+func (s *Session) QueueMoveUp(i int) {
+	s.setError(s.QueueMoveUpE(i))
+}
+
+func QueueMoveUpE(i int) error {
+	return defaultSession.QueueMoveUpE(i)
+}
+
+func (s *Session) QueueMoveUpE(i int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queueMove(i, func(old int, n int) int { return old - 1 })
+}
+
+//export QueueMoveDown
+func QueueMoveDown(i int) {
+	defaultSession.QueueMoveDown(i)
+}
+
+func (s *Session) QueueMoveDown(i int) {
+	s.setError(s.QueueMoveDownE(i))
+}
+
+func QueueMoveDownE(i int) error {
+	return defaultSession.QueueMoveDownE(i)
+}
+
+func (s *Session) QueueMoveDownE(i int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queueMove(i, func(old int, n int) int { return old + 1 })
+}
+
+//export QueueMoveTop
+func QueueMoveTop(i int) {
+	defaultSession.QueueMoveTop(i)
+}
+
+func (s *Session) QueueMoveTop(i int) {
+	s.setError(s.QueueMoveTopE(i))
+}
+
+func QueueMoveTopE(i int) error {
+	return defaultSession.QueueMoveTopE(i)
+}
+
+func (s *Session) QueueMoveTopE(i int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queueMove(i, func(old int, n int) int { return 0 })
+}
+
+//export QueueMoveBottom
+func QueueMoveBottom(i int) {
+	defaultSession.QueueMoveBottom(i)
+}
+
+func (s *Session) QueueMoveBottom(i int) {
+	s.setError(s.QueueMoveBottomE(i))
+}
+
+func QueueMoveBottomE(i int) error {
+	return defaultSession.QueueMoveBottomE(i)
+}
+
+func (s *Session) QueueMoveBottomE(i int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queueMove(i, func(old int, n int) int { return n - 1 })
+}
@@ -0,0 +1,63 @@
+package libtorrent
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestQueueMoveUnknown(t *testing.T) {
+	s := newSession(NewConfig())
+	for _, f := range []func(int) error{s.QueueMoveUpE, s.QueueMoveDownE, s.QueueMoveTopE, s.QueueMoveBottomE} {
+		if err := f(7); err != ErrUnknownTorrent {
+			t.Error(err)
+		}
+	}
+}
+
+func TestQueueStartForced(t *testing.T) {
+	cfg := NewConfig()
+	cfg.BindAddr = ":0"
+	cfg.ActiveDownloads = 1
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "libtorrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a, err := s.AddMagnetE(dir, "magnet:?xt=urn:btih:0000000000000000000000000000000000000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := s.AddMagnetE(dir, "magnet:?xt=urn:btih:0000000000000000000000000000000000000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.StartTorrentE(a); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.ForceStartTorrentE(b); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.StartTorrentE(b); err != nil {
+		t.Fatal(err)
+	}
+
+	active := 0
+	for _, i := range []int{a, b} {
+		if st := s.TorrentStatus(i); st == StatusDownloading {
+			active++
+		} else if st != StatusQueued {
+			t.Error(i, st)
+		}
+	}
+	if active != 1 {
+		t.Error(active)
+	}
+}
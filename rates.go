@@ -0,0 +1,404 @@
+package libtorrent
+
+import (
+	"context"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"golang.org/x/time/rate"
+)
+
+// Rates
+//
+// Upload / download speeds, bytes per second. For limits 0 - unlimited.
+type Rates struct {
+	Upload   int
+	Download int
+}
+
+// TorrentSetUploadRate
+//
+// Limit torrent upload speed, works under session limit set by SetUploadRate.
+// torrent package throttles uploads with one client limiter, so limits apply
+// while every active torrent is limited: session uploads no more then their
+// sum.
+//
+//export TorrentSetUploadRate
+func TorrentSetUploadRate(i int, bps int) {
+	defaultSession.TorrentSetUploadRate(i, bps)
+}
+
+func (s *Session) TorrentSetUploadRate(i int, bps int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[t.InfoHash()]
+	ts.uploadRate = bps
+	ts.dirty = true
+	s.torrentstorageLock.Unlock()
+
+	s.uploadLimitUpdate()
+}
+
+// TorrentSetDownloadRate
+//
+// Limit torrent download speed, works under session limit set by SetDownloadRate.
+//
+//export TorrentSetDownloadRate
+func TorrentSetDownloadRate(i int, bps int) {
+	defaultSession.TorrentSetDownloadRate(i, bps)
+}
+
+func (s *Session) TorrentSetDownloadRate(i int, bps int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+
+	s.torrentstorageLock.Lock()
+	defer s.torrentstorageLock.Unlock()
+
+	ts := s.torrentstorage[t.InfoHash()]
+	ts.setDownloadRate(bps)
+	ts.dirty = true
+}
+
+//export TorrentRates
+func TorrentRates(i int) *Rates {
+	return defaultSession.TorrentRates(i)
+}
+
+func (s *Session) TorrentRates(i int) *Rates {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return nil
+	}
+
+	s.torrentstorageLock.Lock()
+	defer s.torrentstorageLock.Unlock()
+
+	ts := s.torrentstorage[t.InfoHash()]
+	return &Rates{ts.uploadRate, ts.downloadRate}
+}
+
+// lock outside
+func (m *torrentStorage) setDownloadRate(bps int) {
+	m.downloadRate = bps
+	m.downloadLimiter = limit(bps)
+}
+
+// wait for n bytes, limiter does not allow to take more then burst at once
+func limitWait(l *rate.Limiter, n int) {
+	if l.Limit() == rate.Inf {
+		return
+	}
+	b := l.Burst()
+	for n > 0 {
+		c := n
+		if c > b {
+			c = b
+		}
+		l.WaitN(context.Background(), c)
+		n -= c
+	}
+}
+
+// session upload limit, bytes per second, 0 - unlimited. torrent package
+// delays chunks over ClientConfig.UploadRateLimiter and retries them later,
+// peers stay unchoked, but has no per torrent limiter. so torrents limits go
+// through client one: while all active torrents limited session upload capped
+// by their sum. lock outside.
+func (s *Session) uploadLimit() int {
+	sum := 0
+	s.torrentstorageLock.Lock()
+	for t := range s.active {
+		r := s.torrentstorage[t.InfoHash()].uploadRate
+		if r == 0 {
+			sum = 0
+			break
+		}
+		sum += r
+	}
+	s.torrentstorageLock.Unlock()
+	if sum == 0 || (s.cfg.UploadRate > 0 && s.cfg.UploadRate < sum) {
+		return s.cfg.UploadRate
+	}
+	return sum
+}
+
+// replace client upload limiter when limit changed. lock outside.
+func (s *Session) uploadLimitUpdate() {
+	l := s.uploadLimit()
+	if l == s.uploadLimited {
+		return
+	}
+	s.uploadLimited = l
+	s.client.Config(func() { s.clientConfig.UploadRateLimiter = limit(l) })
+}
+
+// RATE_SAMPLES keeps 30 seconds of one second samples (+1 for base), more if
+// Config.SlowWindow is longer
+const RATE_SAMPLES = 31
+
+const (
+	RateWindowShort  = int64(1 * time.Second)
+	RateWindowMedium = int64(5 * time.Second)
+	RateWindowLong   = int64(30 * time.Second)
+)
+
+// rolling rate estimator over cumulative byte counter
+type rateSamples struct {
+	t []int64 // sample time, nanoseconds
+	v []int64 // cumulative bytes
+}
+
+func (m *rateSamples) add(now int64, v int64, n int) {
+	m.t = append(m.t, now)
+	m.v = append(m.v, v)
+	if len(m.t) > n {
+		m.t = m.t[len(m.t)-n:]
+		m.v = m.v[len(m.v)-n:]
+	}
+}
+
+// bytes per second over last 'window' nanoseconds
+func (m *rateSamples) rate(window int64) int64 {
+	l := len(m.t) - 1
+	if l < 1 {
+		return 0
+	}
+	i := l - 1
+	for i > 0 && m.t[l]-m.t[i-1] <= window {
+		i--
+	}
+	d := m.t[l] - m.t[i]
+	if d <= 0 {
+		return 0
+	}
+	b := m.v[l] - m.v[i]
+	if b < 0 { // counters reset (SetStats)
+		return 0
+	}
+	return b * int64(time.Second) / d
+}
+
+type transferRate struct {
+	down rateSamples
+	up   rateSamples
+}
+
+func (m *transferRate) add(now int64, down int64, up int64, n int) {
+	m.down.add(now, down, n)
+	m.up.add(now, up, n)
+}
+
+func (m *transferRate) rates(window int64) *Rates {
+	return &Rates{int(m.up.rate(window)), int(m.down.rate(window))}
+}
+
+type torrentRate struct {
+	transferRate
+	peers map[string]*transferRate
+}
+
+// sample session, torrents and peers byte counters every second
+func (s *Session) ratesEngine() {
+	s.mu.Lock()
+	if s.client == nil {
+		s.mu.Unlock()
+		return
+	}
+	clientClose := s.client.Wait()
+	s.mu.Unlock()
+
+	for {
+		s.mu.Lock()
+		if s.client == nil { // closed
+			s.mu.Unlock()
+			return
+		}
+		s.ratesUpdate(time.Now().UnixNano())
+		s.uploadLimitUpdate() // torrents started / stopped
+		if s.cfg.SlowDownloadRate > 0 || s.cfg.SlowUploadRate > 0 {
+			s.queueFill() // slow torrents release slots
+		}
+		s.streamingUpdateAll()
+		s.seedUpdate()
+		s.mu.Unlock()
+		select {
+		case <-clientClose:
+			return
+		case <-time.After(1 * time.Second):
+		}
+	}
+}
+
+func (s *Session) ratesUpdate(now int64) {
+	n := RATE_SAMPLES
+	if w := int(s.cfg.SlowWindow/int64(time.Second)) + 1; w > n {
+		n = w
+	}
+
+	stats := s.client.Stats()
+	s.rate.add(now, stats.BytesRead.Int64(), stats.BytesWritten.Int64(), n)
+
+	for t := range s.rates { // removed torrents
+		if _, ok := s.filestorage[t.InfoHash()]; !ok {
+			delete(s.rates, t)
+		}
+	}
+
+	for _, t := range s.torrents {
+		r, ok := s.rates[t]
+		if !ok {
+			r = &torrentRate{peers: make(map[string]*transferRate)}
+			s.rates[t] = r
+		}
+		ts := t.Stats()
+		r.add(now, ts.BytesRead.Int64(), ts.BytesWritten.Int64(), n)
+
+		peers := make(map[string]*transferRate)
+		for _, p := range t.Peers() {
+			pr, ok := r.peers[p.Addr]
+			if !ok {
+				pr = &transferRate{}
+			}
+			pr.add(now, p.Downloaded, p.Uploaded, RATE_SAMPLES)
+			peers[p.Addr] = pr
+		}
+		r.peers = peers // disconnected peers removed
+	}
+}
+
+// lock outside
+func (s *Session) torrentRates(t *torrent.Torrent, window int64) *Rates {
+	r, ok := s.rates[t]
+	if !ok {
+		return &Rates{}
+	}
+	return r.rates(window)
+}
+
+// lock outside
+func (s *Session) peerRates(t *torrent.Torrent, addr string, window int64) *Rates {
+	r, ok := s.rates[t]
+	if !ok {
+		return &Rates{}
+	}
+	pr, ok := r.peers[addr]
+	if !ok {
+		return &Rates{}
+	}
+	return pr.rates(window)
+}
+
+// TorrentDownloadRate
+//
+// Current torrent download speed, bytes per second (5 seconds average)
+//
+//export TorrentDownloadRate
+func TorrentDownloadRate(i int) int64 {
+	return defaultSession.TorrentDownloadRate(i)
+}
+
+func (s *Session) TorrentDownloadRate(i int) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
+	return int64(s.torrentRates(t, RateWindowMedium).Download)
+}
+
+// TorrentUploadRate
+//
+// Current torrent upload speed, bytes per second (5 seconds average)
+//
+//export TorrentUploadRate
+func TorrentUploadRate(i int) int64 {
+	return defaultSession.TorrentUploadRate(i)
+}
+
+func (s *Session) TorrentUploadRate(i int) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
+	return int64(s.torrentRates(t, RateWindowMedium).Upload)
+}
+
+// TorrentTransferRates
+//
+// Torrent speed averaged over window (RateWindowShort, RateWindowMedium,
+// RateWindowLong), nanoseconds
+func TorrentTransferRates(i int, window int64) *Rates {
+	return defaultSession.TorrentTransferRates(i, window)
+}
+
+func (s *Session) TorrentTransferRates(i int, window int64) *Rates {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return nil
+	}
+	return s.torrentRates(t, window)
+}
+
+// Session speed averaged over window, nanoseconds
+func TransferRates(window int64) *Rates {
+	return defaultSession.TransferRates(window)
+}
+
+func (s *Session) TransferRates(window int64) *Rates {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rate.rates(window)
+}
+
+// TorrentETA
+//
+// Estimated time to download pending pieces, nanoseconds. 0 - downloaded, -1 -
+// unknown (stalled).
+//
+//export TorrentETA
+func TorrentETA(i int) int64 {
+	return defaultSession.TorrentETA(i)
+}
+
+func (s *Session) TorrentETA(i int) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
+
+	if t.Info() == nil {
+		return -1
+	}
+
+	fb := s.filePendingBitmap(t.InfoHash())
+	left := pendingBytesLength(t, fb) - pendingBytesCompleted(t, fb)
+	if left <= 0 {
+		return 0
+	}
+
+	r := int64(s.torrentRates(t, RateWindowLong).Download)
+	if r <= 0 {
+		return -1
+	}
+	return left * int64(time.Second) / r
+}
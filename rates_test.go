@@ -0,0 +1,88 @@
+package libtorrent
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestRateSamples(t *testing.T) {
+	var m rateSamples
+
+	if r := m.rate(RateWindowMedium); r != 0 {
+		t.Error(r)
+	}
+
+	s := int64(time.Second)
+	for i := int64(0); i <= 40; i++ {
+		m.add(i*s, i*100, RATE_SAMPLES) // 100 bytes per second
+	}
+	if len(m.t) != RATE_SAMPLES {
+		t.Error(len(m.t))
+	}
+	for _, w := range []int64{RateWindowShort, RateWindowMedium, RateWindowLong} {
+		if r := m.rate(w); r != 100 {
+			t.Error(w, r)
+		}
+	}
+}
+
+func TestUploadLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libtorrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := NewConfig()
+	cfg.BindAddr = ":0"
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	var ii []int
+	for _, name := range []string{"a", "b"} {
+		info, err := bencode.Marshal(metainfo.Info{Name: name, PieceLength: 16 * 1024, Length: 1, Pieces: make([]byte, 20)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		err = (&metainfo.MetaInfo{InfoBytes: info}).Write(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		i, err := s.AddTorrentFromBytesE(dir, buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		ii = append(ii, i)
+	}
+	limited := func() int {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.active = map[*torrent.Torrent]int64{s.torrents[ii[0]]: 0, s.torrents[ii[1]]: 0} // no network
+		s.uploadLimitUpdate()
+		return s.uploadLimited
+	}
+
+	s.TorrentSetUploadRate(ii[0], 1000)
+	if l := limited(); l != 0 { // second torrent unlimited
+		t.Error(l)
+	}
+	s.TorrentSetUploadRate(ii[1], 2000)
+	if l := limited(); l != 3000 {
+		t.Error(l)
+	}
+	s.SetUploadRate(500)
+	if l := limited(); l != 500 {
+		t.Error(l)
+	}
+}
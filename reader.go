@@ -0,0 +1,217 @@
+package libtorrent
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// ReadSeekCloser
+//
+// io.ReadSeekCloser, not available on go1.13
+type ReadSeekCloser interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+}
+
+// TorrentFileReader
+//
+// Open torrent file 'p' for reading. Read() blocks until pieces downloaded and
+// verified, pieces ahead of reading position downloaded first
+// (Config.StreamingReadahead). Torrent has to be active to receive missing
+// pieces. Renamed files and external storage supported.
+func TorrentFileReader(i int, p int) (ReadSeekCloser, error) {
+	return defaultSession.TorrentFileReader(i, p)
+}
+
+func (s *Session) TorrentFileReader(i int, p int) (ReadSeekCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return nil, err
+	}
+	if t.Info() == nil {
+		return nil, ErrNoMetadata
+	}
+
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[t.InfoHash()]
+	info := ts.info
+	s.torrentstorageLock.Unlock()
+
+	ff := info.UpvertedFiles()
+	if p < 0 || p >= len(ff) {
+		return nil, ErrUnknownFile
+	}
+
+	offset, _ := fileRange(info, p)
+
+	r := &fileReader{
+		s:      s,
+		t:      t,
+		fst:    &fileStorageTorrent{info, ts, t.InfoHash().HexString()},
+		index:  p,
+		fi:     ff[p],
+		offset: offset,
+		piece:  -1,
+		closed: make(chan struct{}),
+	}
+
+	fs := s.filestorage[t.InfoHash()]
+	if fs.readers == nil {
+		fs.readers = make(map[*fileReader]int64)
+	}
+	fs.readers[r] = 0
+	s.streamingUpdate(t)
+
+	return r, nil
+}
+
+type fileReader struct {
+	s      *Session
+	t      *torrent.Torrent
+	fst    *fileStorageTorrent
+	index  int
+	fi     metainfo.FileInfo
+	offset int64 // file offset inside torrent
+
+	mu    sync.Mutex
+	pos   int64
+	piece int // last piece position reported to streamingUpdate()
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (m *fileReader) Read(b []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	case <-m.closed:
+		return 0, ErrClosed
+	default:
+	}
+
+	if m.pos >= m.fi.Length {
+		return 0, io.EOF
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	plen := m.fst.info.PieceLength
+	off := m.offset + m.pos
+	piece := int(off / plen)
+
+	// read single piece at once
+	if n := int64(piece+1)*plen - off; int64(len(b)) > n {
+		b = b[:n]
+	}
+	if n := m.fi.Length - m.pos; int64(len(b)) > n {
+		b = b[:n]
+	}
+
+	if piece != m.piece {
+		m.piece = piece
+		m.position()
+	}
+
+	err := m.wait(piece)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := m.fst.readFileAt(m.index, m.fi, b, m.pos)
+	m.pos += int64(n)
+	if err == io.EOF {
+		if n > 0 {
+			err = nil
+		} else { // piece verified, but file missing or short
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	return n, err
+}
+
+// report reading position, move read-ahead window
+func (m *fileReader) position() {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+	fs, ok := m.s.filestorage[m.t.InfoHash()]
+	if !ok { // removed
+		return
+	}
+	if _, ok := fs.readers[m]; !ok { // closed
+		return
+	}
+	fs.readers[m] = m.pos
+	m.s.streamingUpdate(m.t)
+}
+
+func (m *fileReader) completed(piece int) bool {
+	m.s.torrentstorageLock.Lock()
+	defer m.s.torrentstorageLock.Unlock()
+	return m.fst.ts.completedPieces.Contains(piece)
+}
+
+// wait for piece downloaded and verified
+func (m *fileReader) wait(piece int) error {
+	if m.completed(piece) {
+		return nil
+	}
+	sub := m.t.SubscribePieceStateChanges()
+	defer sub.Close()
+	for !m.completed(piece) {
+		select {
+		case <-sub.Values:
+		case <-m.t.Closed(): // torrent removed
+			return ErrClosed
+		case <-m.closed:
+			return ErrClosed
+		}
+	}
+	return nil
+}
+
+func (m *fileReader) Seek(offset int64, whence int) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += m.pos
+	case io.SeekEnd:
+		offset += m.fi.Length
+	default:
+		return m.pos, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return m.pos, errors.New("negative position")
+	}
+	m.pos = offset
+	return m.pos, nil
+}
+
+func (m *fileReader) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.closed)
+
+		m.s.mu.Lock()
+		defer m.s.mu.Unlock()
+		fs, ok := m.s.filestorage[m.t.InfoHash()]
+		if !ok {
+			return
+		}
+		delete(fs.readers, m)
+		m.s.streamingUpdate(m.t)
+	})
+	return nil
+}
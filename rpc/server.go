@@ -0,0 +1,136 @@
+// Package rpc implements Transmission compatible JSON-RPC server over
+// libtorrent Session, so Transmission front-ends (web, desktop, remote) can
+// control the library.
+//
+// https://github.com/transmission/transmission/blob/master/extras/rpc-spec.txt
+package rpc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/gitpubber/libtorrent"
+)
+
+const (
+	RPCVersion    = 15
+	RPCVersionMin = 1
+
+	// CSRF protection header
+	SessionIdHeader = "X-Transmission-Session-Id"
+)
+
+// Server
+//
+// http.Handler serving Transmission RPC requests, usually mounted on
+// "/transmission/rpc".
+type Server struct {
+	s           *libtorrent.Session
+	downloadDir string
+
+	mu        sync.Mutex
+	sessionId string
+	limits    map[string]float64 // last session limits values, see limit()
+}
+
+type request struct {
+	Method    string          `json:"method"`
+	Arguments json.RawMessage `json:"arguments"`
+	Tag       *int            `json:"tag,omitempty"`
+}
+
+type response struct {
+	Result    string      `json:"result"`
+	Arguments interface{} `json:"arguments"`
+	Tag       *int        `json:"tag,omitempty"`
+}
+
+type handler func(m *Server, args json.RawMessage) (interface{}, error)
+
+var methods = map[string]handler{
+	"torrent-get":        (*Server).torrentGet,
+	"torrent-add":        (*Server).torrentAdd,
+	"torrent-start":      (*Server).torrentStart,
+	"torrent-start-now":  (*Server).torrentStartNow,
+	"torrent-stop":       (*Server).torrentStop,
+	"torrent-remove":     (*Server).torrentRemove,
+	"torrent-set":        (*Server).torrentSet,
+	"torrent-reannounce": (*Server).torrentReannounce,
+	"session-get":        (*Server).sessionGet,
+	"session-set":        (*Server).sessionSet,
+}
+
+// NewServer
+//
+// RPC server over session 's', new torrents saved to 'downloadDir' unless
+// torrent-add "download-dir" set.
+func NewServer(s *libtorrent.Session, downloadDir string) *Server {
+	return &Server{s: s, downloadDir: downloadDir, sessionId: newSessionId()}
+}
+
+func newSessionId() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SessionId
+//
+// Current CSRF token, clients get it from 409 response header.
+func (m *Server) SessionId() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sessionId
+}
+
+func (m *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := m.SessionId()
+	if r.Header.Get(SessionIdHeader) != id {
+		w.Header().Set(SessionIdHeader, id)
+		http.Error(w, "invalid "+SessionIdHeader, http.StatusConflict)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req request
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := response{Result: "success", Arguments: struct{}{}, Tag: req.Tag}
+
+	h, ok := methods[req.Method]
+	if !ok {
+		resp.Result = "method name not recognized"
+	} else {
+		args, err := h(m, req.Arguments)
+		if err != nil {
+			resp.Result = err.Error()
+		}
+		if args != nil {
+			resp.Arguments = args
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&resp)
+}
+
+// decode request arguments, missing arguments is not an error
+func decode(args json.RawMessage, v interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+	return json.Unmarshal(args, v)
+}
+
+var errInvalidArguments = errors.New("invalid arguments")
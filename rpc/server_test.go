@@ -0,0 +1,39 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSessionId(t *testing.T) {
+	m := NewServer(nil, "")
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("POST", "/transmission/rpc", strings.NewReader(`{"method":"session-get"}`)))
+	if w.Code != http.StatusConflict {
+		t.Fatal(w.Code)
+	}
+	id := w.Header().Get(SessionIdHeader)
+	if id != m.SessionId() {
+		t.Fatal(id)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/transmission/rpc", strings.NewReader(`{"method":"unknown","tag":7}`))
+	r.Header.Set(SessionIdHeader, id)
+	m.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatal(w.Code)
+	}
+	var resp response
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Result != "method name not recognized" || resp.Tag == nil || *resp.Tag != 7 {
+		t.Error(resp)
+	}
+}
@@ -0,0 +1,116 @@
+package rpc
+
+import (
+	"encoding/json"
+
+	"github.com/gitpubber/libtorrent"
+)
+
+// Transmission keeps limit value and enabled flag separately, libtorrent uses
+// 0 for disabled. remember last value to report / enable it back.
+func (m *Server) limit(key string, cur float64, value *float64, enabled *bool) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.limits == nil {
+		m.limits = make(map[string]float64)
+	}
+	if cur > 0 {
+		m.limits[key] = cur
+	}
+	if value != nil {
+		m.limits[key] = *value
+	}
+	on := cur > 0
+	if enabled != nil {
+		on = *enabled
+	}
+	if !on {
+		return 0
+	}
+	return m.limits[key]
+}
+
+// current or last known limit value, for disabled limits
+func (m *Server) limitValue(key string, cur float64) float64 {
+	if cur > 0 {
+		return cur
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.limits[key]
+}
+
+func (m *Server) sessionGet(args json.RawMessage) (interface{}, error) {
+	cfg := m.s.GetConfig()
+
+	m.mu.Lock()
+	dir := m.downloadDir
+	id := m.sessionId
+	m.mu.Unlock()
+
+	return map[string]interface{}{
+		"rpc-version":              RPCVersion,
+		"rpc-version-minimum":      RPCVersionMin,
+		"version":                  "libtorrent " + libtorrent.Version,
+		"session-id":               id,
+		"download-dir":             dir,
+		"peer-limit-per-torrent":   cfg.SocketsPerTorrent,
+		"speed-limit-down":         int(m.limitValue("speed-limit-down", float64(cfg.DownloadRate))) / kilo,
+		"speed-limit-down-enabled": cfg.DownloadRate > 0,
+		"speed-limit-up":           int(m.limitValue("speed-limit-up", float64(cfg.UploadRate))) / kilo,
+		"speed-limit-up-enabled":   cfg.UploadRate > 0,
+		"download-queue-size":      int(m.limitValue("download-queue-size", float64(cfg.ActiveDownloads))),
+		"download-queue-enabled":   cfg.ActiveDownloads > 0,
+		"seed-queue-size":          int(m.limitValue("seed-queue-size", float64(cfg.ActiveSeeds))),
+		"seed-queue-enabled":       cfg.ActiveSeeds > 0,
+		"seedRatioLimit":           m.limitValue("seedRatioLimit", cfg.SeedRatio),
+		"seedRatioLimited":         cfg.SeedRatio > 0,
+		"units": map[string]interface{}{
+			"speed-bytes": kilo,
+			"speed-units": []string{"kB/s", "MB/s", "GB/s", "TB/s"},
+		},
+	}, nil
+}
+
+func (m *Server) sessionSet(args json.RawMessage) (interface{}, error) {
+	var a struct {
+		DownloadDir           *string  `json:"download-dir"`
+		SpeedLimitDown        *float64 `json:"speed-limit-down"`
+		SpeedLimitDownEnabled *bool    `json:"speed-limit-down-enabled"`
+		SpeedLimitUp          *float64 `json:"speed-limit-up"`
+		SpeedLimitUpEnabled   *bool    `json:"speed-limit-up-enabled"`
+		DownloadQueueSize     *float64 `json:"download-queue-size"`
+		DownloadQueueEnabled  *bool    `json:"download-queue-enabled"`
+		SeedQueueSize         *float64 `json:"seed-queue-size"`
+		SeedQueueEnabled      *bool    `json:"seed-queue-enabled"`
+		SeedRatioLimit        *float64 `json:"seedRatioLimit"`
+		SeedRatioLimited      *bool    `json:"seedRatioLimited"`
+	}
+	err := decode(args, &a)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.DownloadDir != nil {
+		m.mu.Lock()
+		m.downloadDir = *a.DownloadDir
+		m.mu.Unlock()
+	}
+
+	kb := func(v *float64) *float64 {
+		if v == nil {
+			return nil
+		}
+		b := *v * kilo
+		return &b
+	}
+
+	cfg := m.s.GetConfig()
+	cfg.DownloadRate = int(m.limit("speed-limit-down", float64(cfg.DownloadRate), kb(a.SpeedLimitDown), a.SpeedLimitDownEnabled))
+	cfg.UploadRate = int(m.limit("speed-limit-up", float64(cfg.UploadRate), kb(a.SpeedLimitUp), a.SpeedLimitUpEnabled))
+	cfg.ActiveDownloads = int(m.limit("download-queue-size", float64(cfg.ActiveDownloads), a.DownloadQueueSize, a.DownloadQueueEnabled))
+	cfg.ActiveSeeds = int(m.limit("seed-queue-size", float64(cfg.ActiveSeeds), a.SeedQueueSize, a.SeedQueueEnabled))
+	cfg.SeedRatio = m.limit("seedRatioLimit", cfg.SeedRatio, a.SeedRatioLimit, a.SeedRatioLimited)
+
+	return nil, m.s.ApplyConfig(cfg)
+}
@@ -0,0 +1,693 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/gitpubber/libtorrent"
+)
+
+// transmission torrent status
+const (
+	statusStopped      = 0
+	statusCheckWait    = 1
+	statusCheck        = 2
+	statusDownloadWait = 3
+	statusDownload     = 4
+	statusSeedWait     = 5
+	statusSeed         = 6
+)
+
+// transmission file priorities
+const (
+	priorityLow    = -1
+	priorityNormal = 0
+	priorityHigh   = 1
+)
+
+// speed limits are in kB/s
+const kilo = 1000
+
+// resolve "ids" argument: number, list of numbers / hash strings, or
+// "recently-active". missing - all torrents.
+func (m *Server) ids(raw json.RawMessage) ([]int, error) {
+	all := m.s.Torrents()
+	if len(raw) == 0 {
+		return all, nil
+	}
+
+	var list []interface{}
+	var n int
+	var str string
+	switch {
+	case json.Unmarshal(raw, &n) == nil:
+		list = []interface{}{float64(n)}
+	case json.Unmarshal(raw, &str) == nil:
+		if str != "recently-active" {
+			list = []interface{}{str}
+		} else {
+			return all, nil
+		}
+	case json.Unmarshal(raw, &list) == nil:
+	default:
+		return nil, errInvalidArguments
+	}
+
+	var ids []int
+	for _, i := range all {
+		for _, v := range list {
+			switch v := v.(type) {
+			case float64:
+				if int(v) == i {
+					ids = append(ids, i)
+				}
+			case string:
+				if strings.EqualFold(v, m.s.TorrentHash(i)) {
+					ids = append(ids, i)
+				}
+			}
+		}
+	}
+	return ids, nil
+}
+
+type idsArgs struct {
+	Ids json.RawMessage `json:"ids"`
+}
+
+func (m *Server) status(i int) int {
+	meta := m.s.MetaTorrent(i)
+	switch m.s.TorrentStatus(i) {
+	case libtorrent.StatusChecking:
+		return statusCheck
+	case libtorrent.StatusQueued:
+		if meta && m.s.PendingCompleted(i) {
+			return statusSeedWait
+		}
+		return statusDownloadWait
+	case libtorrent.StatusDownloading:
+		return statusDownload
+	case libtorrent.StatusSeeding:
+		return statusSeed
+	case libtorrent.StatusForced:
+		if meta && m.s.PendingCompleted(i) {
+			return statusSeed
+		}
+		return statusDownload
+	}
+	return statusStopped
+}
+
+func seconds(ns int64) int64 {
+	return ns / int64(time.Second)
+}
+
+func filePriority(prio int32) int {
+	switch prio {
+	case libtorrent.FilePriorityLow:
+		return priorityLow
+	case libtorrent.FilePriorityHigh, libtorrent.FilePriorityMaximum:
+		return priorityHigh
+	}
+	return priorityNormal
+}
+
+func (m *Server) files(i int) []*libtorrent.File {
+	var ff []*libtorrent.File
+	if !m.s.MetaTorrent(i) {
+		return ff
+	}
+	n := m.s.TorrentFilesCount(i)
+	for p := 0; p < n; p++ {
+		ff = append(ff, m.s.TorrentFiles(i, p))
+	}
+	return ff
+}
+
+func (m *Server) trackers(i int) []*libtorrent.Tracker {
+	var tt []*libtorrent.Tracker
+	n := m.s.TorrentTrackersCount(i)
+	for p := 0; p < n; p++ {
+		t := m.s.TorrentTrackers(i, p)
+		if t != nil && strings.Contains(t.Addr, "://") && t.Enabled { // skip LPD / DHT, disabled trackers
+			tt = append(tt, t)
+		}
+	}
+	return tt
+}
+
+// torrent-get field value, false - unknown field
+func (m *Server) field(i int, name string) (interface{}, bool) {
+	meta := m.s.MetaTorrent(i)
+
+	switch name {
+	case "id":
+		return i, true
+	case "hashString":
+		return m.s.TorrentHash(i), true
+	case "name":
+		return m.s.TorrentName(i), true
+	case "status":
+		return m.status(i), true
+	case "error":
+		return 0, true
+	case "errorString":
+		return "", true
+	case "downloadDir":
+		return m.s.TorrentPath(i), true
+	case "magnetLink":
+		return m.s.TorrentMagnet(i), true
+	case "isFinished":
+		return meta && m.s.PendingCompleted(i), true
+	case "metadataPercentComplete":
+		if meta {
+			return 1, true
+		}
+		return 0, true
+	case "totalSize":
+		if !meta {
+			return 0, true
+		}
+		return m.s.TorrentBytesLength(i), true
+	case "sizeWhenDone":
+		if !meta {
+			return 0, true
+		}
+		return m.s.TorrentPendingBytesLength(i), true
+	case "leftUntilDone":
+		if !meta {
+			return 0, true
+		}
+		return m.s.TorrentPendingBytesLength(i) - m.s.TorrentPendingBytesCompleted(i), true
+	case "haveValid":
+		if !meta {
+			return 0, true
+		}
+		return m.s.TorrentBytesCompleted(i), true
+	case "percentDone":
+		if !meta {
+			return 0, true
+		}
+		l := m.s.TorrentPendingBytesLength(i)
+		if l == 0 {
+			return 1, true
+		}
+		return float64(m.s.TorrentPendingBytesCompleted(i)) / float64(l), true
+	case "rateDownload":
+		return m.s.TorrentDownloadRate(i), true
+	case "rateUpload":
+		return m.s.TorrentUploadRate(i), true
+	case "eta":
+		eta := m.s.TorrentETA(i)
+		if eta < 0 {
+			return -1, true
+		}
+		return seconds(eta), true
+	case "downloadedEver":
+		return m.s.TorrentStats(i).Downloaded, true
+	case "uploadedEver":
+		return m.s.TorrentStats(i).Uploaded, true
+	case "uploadRatio":
+		st := m.s.TorrentStats(i)
+		if st.Downloaded == 0 {
+			return -1, true
+		}
+		return float64(st.Uploaded) / float64(st.Downloaded), true
+	case "secondsDownloading":
+		return seconds(m.s.TorrentStats(i).Downloading), true
+	case "secondsSeeding":
+		return seconds(m.s.TorrentStats(i).Seeding), true
+	case "addedDate":
+		return seconds(m.s.TorrentInfo(i).DateAdded), true
+	case "doneDate":
+		return seconds(m.s.TorrentInfo(i).DateCompleted), true
+	case "dateCreated":
+		return seconds(m.s.TorrentInfo(i).CreateOn), true
+	case "comment":
+		return m.s.TorrentInfo(i).Comment, true
+	case "creator":
+		return m.s.TorrentInfo(i).Creator, true
+	case "queuePosition":
+		return m.s.QueuePosition(i), true
+	case "sequentialDownload":
+		return m.s.TorrentSequential(i), true
+	case "pieceCount":
+		if !meta {
+			return 0, true
+		}
+		return m.s.TorrentPiecesCount(i), true
+	case "pieceSize":
+		if !meta {
+			return 0, true
+		}
+		return m.s.TorrentPieceLength(i), true
+	case "downloadLimit":
+		return m.s.TorrentRates(i).Download / kilo, true
+	case "downloadLimited":
+		return m.s.TorrentRates(i).Download > 0, true
+	case "uploadLimit":
+		return m.s.TorrentRates(i).Upload / kilo, true
+	case "uploadLimited":
+		return m.s.TorrentRates(i).Upload > 0, true
+	case "seedRatioLimit":
+		return m.s.TorrentSeedLimits(i).Ratio, true
+	case "seedRatioMode":
+		switch r := m.s.TorrentSeedLimits(i).Ratio; {
+		case r > 0:
+			return 1, true
+		case r < 0:
+			return 2, true
+		}
+		return 0, true
+	case "files":
+		var ff []interface{}
+		for _, f := range m.files(i) {
+			ff = append(ff, map[string]interface{}{"name": f.Path, "length": f.Length, "bytesCompleted": f.BytesCompleted})
+		}
+		return ff, true
+	case "fileStats":
+		var ff []interface{}
+		for _, f := range m.files(i) {
+			ff = append(ff, map[string]interface{}{"bytesCompleted": f.BytesCompleted, "wanted": f.Check, "priority": filePriority(f.Priority)})
+		}
+		return ff, true
+	case "wanted":
+		var ff []int
+		for _, f := range m.files(i) {
+			w := 0
+			if f.Check {
+				w = 1
+			}
+			ff = append(ff, w)
+		}
+		return ff, true
+	case "priorities":
+		var ff []int
+		for _, f := range m.files(i) {
+			ff = append(ff, filePriority(f.Priority))
+		}
+		return ff, true
+	case "peers":
+		var pp []interface{}
+		pieces := 0
+		if meta {
+			pieces = m.s.TorrentPiecesCount(i)
+		}
+		n := m.s.TorrentPeersCount(i)
+		for p := 0; p < n; p++ {
+			peer := m.s.TorrentPeers(i, p)
+			host, port, _ := net.SplitHostPort(peer.Addr)
+			portn, _ := strconv.Atoi(port)
+			var progress float64
+			if pieces > 0 {
+				progress = float64(peer.PiecesCompleted) / float64(pieces)
+			}
+			pp = append(pp, map[string]interface{}{
+				"address":      host,
+				"port":         portn,
+				"clientName":   peer.Name,
+				"isEncrypted":  peer.SupportsEncryption,
+				"progress":     progress,
+				"rateToClient": peer.DownloadRate,
+				"rateToPeer":   peer.UploadRate,
+				"flagStr":      peer.Source,
+			})
+		}
+		return pp, true
+	case "peersConnected":
+		return m.s.TorrentPeersCount(i), true
+	case "trackers":
+		var tt []interface{}
+		for id, t := range m.trackers(i) {
+			tt = append(tt, map[string]interface{}{"id": id, "announce": t.Addr, "scrape": "", "tier": t.Tier})
+		}
+		return tt, true
+	case "trackerList":
+		list := ""
+		tt := m.trackers(i)
+		for id, t := range tt {
+			if id > 0 {
+				list += "\n"
+				if t.Tier != tt[id-1].Tier { // empty line between tiers
+					list += "\n"
+				}
+			}
+			list += t.Addr
+		}
+		return list, true
+	case "trackerStats":
+		var tt []interface{}
+		for id, t := range m.trackers(i) {
+			result := "Success"
+			if t.Error != "" {
+				result = t.Error
+			}
+			host := t.Addr
+			if k := strings.Index(host, "://"); k != -1 {
+				host = host[k+3:]
+			}
+			tt = append(tt, map[string]interface{}{
+				"id":                    id,
+				"announce":              t.Addr,
+				"host":                  host,
+				"tier":                  t.Tier,
+				"lastAnnounceTime":      seconds(t.LastAnnounce),
+				"nextAnnounceTime":      seconds(t.NextAnnounce),
+				"lastAnnouncePeerCount": t.Peers,
+				"lastAnnounceResult":    result,
+				"lastAnnounceSucceeded": t.Error == "",
+				"lastScrapeTime":        seconds(t.LastScrape),
+				"lastScrapeResult":      t.ScrapeError,
+				"lastScrapeSucceeded":   t.LastScrape != 0 && t.ScrapeError == "",
+				"hasScraped":            t.LastScrape != 0,
+				"seederCount":           t.Seeders,
+				"leecherCount":          t.Leechers,
+				"downloadCount":         t.Downloaded,
+			})
+		}
+		return tt, true
+	}
+	return nil, false
+}
+
+func (m *Server) torrentGet(args json.RawMessage) (interface{}, error) {
+	var a struct {
+		idsArgs
+		Fields []string `json:"fields"`
+	}
+	err := decode(args, &a)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := m.ids(a.Ids)
+	if err != nil {
+		return nil, err
+	}
+
+	tt := []interface{}{}
+	for _, i := range ids {
+		t := make(map[string]interface{})
+		for _, f := range a.Fields {
+			if v, ok := m.field(i, f); ok {
+				t[f] = v
+			}
+		}
+		tt = append(tt, t)
+	}
+	return map[string]interface{}{"torrents": tt}, nil
+}
+
+func (m *Server) torrentAdd(args json.RawMessage) (interface{}, error) {
+	var a struct {
+		Filename    string `json:"filename"`
+		Metainfo    string `json:"metainfo"` // base64
+		DownloadDir string `json:"download-dir"`
+		Paused      bool   `json:"paused"`
+	}
+	err := decode(args, &a)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := a.DownloadDir
+	if dir == "" {
+		dir = m.downloadDir
+	}
+
+	var i int
+	var hash metainfo.Hash
+	var buf []byte
+	switch {
+	case a.Metainfo != "":
+		buf, err = base64.StdEncoding.DecodeString(a.Metainfo)
+	case strings.HasPrefix(a.Filename, "magnet:"):
+		if mag, err := metainfo.ParseMagnetURI(a.Filename); err == nil {
+			hash = mag.InfoHash
+		}
+		i, err = m.s.AddMagnetE(dir, a.Filename)
+	case strings.HasPrefix(a.Filename, "http://") || strings.HasPrefix(a.Filename, "https://"):
+		buf, err = fetch(a.Filename)
+	case a.Filename != "":
+		buf, err = ioutil.ReadFile(a.Filename)
+	default:
+		return nil, errInvalidArguments
+	}
+	if buf != nil && err == nil { // .torrent from any source, hash known for duplicates
+		if mi, err := metainfo.Load(bytes.NewReader(buf)); err == nil {
+			hash = mi.HashInfoBytes()
+		}
+		i, err = m.s.AddTorrentFromBytesE(dir, buf)
+	}
+
+	if err == libtorrent.ErrAlreadyExists {
+		for _, k := range m.s.Torrents() {
+			if m.s.TorrentHash(k) == hash.HexString() {
+				return map[string]interface{}{"torrent-duplicate": m.added(k)}, nil
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !a.Paused {
+		err = m.s.StartTorrentE(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]interface{}{"torrent-added": m.added(i)}, nil
+}
+
+// download .torrent file for torrent-add
+func fetch(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (m *Server) added(i int) map[string]interface{} {
+	return map[string]interface{}{"id": i, "name": m.s.TorrentName(i), "hashString": m.s.TorrentHash(i)}
+}
+
+func (m *Server) torrentAction(args json.RawMessage, f func(i int) error) (interface{}, error) {
+	var a idsArgs
+	err := decode(args, &a)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := m.ids(a.Ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range ids {
+		err = f(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (m *Server) torrentStart(args json.RawMessage) (interface{}, error) {
+	return m.torrentAction(args, m.s.StartTorrentE)
+}
+
+func (m *Server) torrentStartNow(args json.RawMessage) (interface{}, error) {
+	return m.torrentAction(args, m.s.ForceStartTorrentE)
+}
+
+func (m *Server) torrentStop(args json.RawMessage) (interface{}, error) {
+	return m.torrentAction(args, func(i int) error {
+		m.s.StopTorrent(i)
+		return nil
+	})
+}
+
+func (m *Server) torrentReannounce(args json.RawMessage) (interface{}, error) {
+	return m.torrentAction(args, func(i int) error {
+		m.s.TorrentReannounce(i)
+		return nil
+	})
+}
+
+func (m *Server) torrentRemove(args json.RawMessage) (interface{}, error) {
+	var a struct {
+		DeleteLocalData bool `json:"delete-local-data"`
+	}
+	err := decode(args, &a)
+	if err != nil {
+		return nil, err
+	}
+	return m.torrentAction(args, func(i int) error {
+		if a.DeleteLocalData {
+			return m.s.RemoveTorrentDataE(i)
+		}
+		m.s.RemoveTorrent(i)
+		return nil
+	})
+}
+
+func (m *Server) torrentSet(args json.RawMessage) (interface{}, error) {
+	var a struct {
+		idsArgs
+		FilesWanted        []int    `json:"files-wanted"`
+		FilesUnwanted      []int    `json:"files-unwanted"`
+		PriorityHigh       []int    `json:"priority-high"`
+		PriorityLow        []int    `json:"priority-low"`
+		PriorityNormal     []int    `json:"priority-normal"`
+		DownloadLimit      *int     `json:"downloadLimit"`
+		DownloadLimited    *bool    `json:"downloadLimited"`
+		UploadLimit        *int     `json:"uploadLimit"`
+		UploadLimited      *bool    `json:"uploadLimited"`
+		SeedRatioLimit     *float64 `json:"seedRatioLimit"`
+		SeedRatioMode      *int     `json:"seedRatioMode"`
+		QueuePosition      *int     `json:"queuePosition"`
+		TrackerAdd         []string `json:"trackerAdd"`
+		TrackerRemove      []int    `json:"trackerRemove"`
+		TrackerList        *string  `json:"trackerList"`
+		SequentialDownload *bool    `json:"sequentialDownload"`
+	}
+	err := decode(args, &a)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := m.ids(a.Ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range ids {
+		if m.s.MetaTorrent(i) {
+			n := m.s.TorrentFilesCount(i)
+			for _, p := range a.FilesWanted {
+				if p >= 0 && p < n {
+					m.s.TorrentFilesCheck(i, p, true)
+				}
+			}
+			for _, p := range a.FilesUnwanted {
+				if p >= 0 && p < n {
+					m.s.TorrentFilesCheck(i, p, false)
+				}
+			}
+			for prio, pp := range map[int32][]int{
+				libtorrent.FilePriorityHigh:   a.PriorityHigh,
+				libtorrent.FilePriorityLow:    a.PriorityLow,
+				libtorrent.FilePriorityNormal: a.PriorityNormal,
+			} {
+				if pp == nil {
+					continue
+				}
+				if len(pp) == 0 { // empty list - all files
+					for p := 0; p < n; p++ {
+						pp = append(pp, p)
+					}
+				}
+				for _, p := range pp {
+					if p < 0 || p >= n || !m.s.TorrentFiles(i, p).Check { // keep unwanted files skipped
+						continue
+					}
+					err = m.s.TorrentFilesPriorityE(i, p, prio)
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+
+		r := m.s.TorrentRates(i)
+		if a.DownloadLimit != nil || a.DownloadLimited != nil {
+			bps := r.Download
+			if a.DownloadLimit != nil {
+				bps = *a.DownloadLimit * kilo
+			}
+			if a.DownloadLimited != nil && !*a.DownloadLimited {
+				bps = 0
+			}
+			m.s.TorrentSetDownloadRate(i, bps)
+		}
+		if a.UploadLimit != nil || a.UploadLimited != nil {
+			bps := r.Upload
+			if a.UploadLimit != nil {
+				bps = *a.UploadLimit * kilo
+			}
+			if a.UploadLimited != nil && !*a.UploadLimited {
+				bps = 0
+			}
+			m.s.TorrentSetUploadRate(i, bps)
+		}
+
+		if a.SeedRatioLimit != nil || a.SeedRatioMode != nil {
+			l := m.s.TorrentSeedLimits(i)
+			ratio := l.Ratio
+			if a.SeedRatioLimit != nil {
+				ratio = *a.SeedRatioLimit
+			}
+			if a.SeedRatioMode != nil {
+				switch *a.SeedRatioMode {
+				case 0: // global
+					ratio = 0
+				case 2: // unlimited
+					ratio = -1
+				}
+			}
+			m.s.TorrentSetSeedLimits(i, ratio, l.Time, l.Action)
+		}
+
+		if a.QueuePosition != nil {
+			for k := m.s.QueuePosition(i); k > *a.QueuePosition && k > 0; k-- {
+				m.s.QueueMoveUp(i)
+			}
+			for k, n := m.s.QueuePosition(i), m.s.Count(); k < *a.QueuePosition && k < n-1; k++ {
+				m.s.QueueMoveDown(i)
+			}
+		}
+
+		for _, t := range a.TrackerAdd {
+			err = m.s.TorrentTrackerAddE(i, t)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(a.TrackerRemove) > 0 {
+			tt := m.trackers(i)
+			for _, id := range a.TrackerRemove {
+				if id >= 0 && id < len(tt) {
+					err = m.s.TorrentTrackerRemoveE(i, tt[id].Addr)
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+
+		if a.TrackerList != nil {
+			err = m.s.TorrentTrackersSetTiersE(i, *a.TrackerList)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if a.SequentialDownload != nil {
+			m.s.TorrentSetSequential(i, *a.SequentialDownload)
+		}
+	}
+
+	return nil, nil
+}
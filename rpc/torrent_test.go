@@ -0,0 +1,134 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/gitpubber/libtorrent"
+)
+
+func call(t *testing.T, m *Server, method string, args interface{}) (string, map[string]interface{}) {
+	buf, err := json.Marshal(map[string]interface{}{"method": method, "arguments": args})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/transmission/rpc", bytes.NewReader(buf))
+	r.Header.Set(SessionIdHeader, m.SessionId())
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, r)
+	var resp struct {
+		Result    string                 `json:"result"`
+		Arguments map[string]interface{} `json:"arguments"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(w.Body.String())
+	}
+	return resp.Result, resp.Arguments
+}
+
+func TestTorrentAddMetainfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libtorrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := libtorrent.NewConfig()
+	cfg.BindAddr = ":0"
+	s, err := libtorrent.NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	m := NewServer(s, dir)
+
+	info, err := bencode.Marshal(metainfo.Info{Name: "a", PieceLength: 16 * 1024, Length: 1, Pieces: make([]byte, 20)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = (&metainfo.MetaInfo{InfoBytes: info}).Write(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := map[string]interface{}{"metainfo": base64.StdEncoding.EncodeToString(buf.Bytes()), "paused": true}
+
+	res, a := call(t, m, "torrent-add", args)
+	if res != "success" || a["torrent-added"] == nil {
+		t.Fatal(res, a)
+	}
+	res, a = call(t, m, "torrent-add", args)
+	if res != "success" || a["torrent-duplicate"] == nil {
+		t.Fatal(res, a)
+	}
+
+	res, _ = call(t, m, "torrent-add", map[string]interface{}{"metainfo": base64.StdEncoding.EncodeToString([]byte("bad"))})
+	if res == "success" || strings.Contains(res, "panic") {
+		t.Fatal(res)
+	}
+	if n := len(s.Torrents()); n != 1 {
+		t.Fatal(n)
+	}
+}
+
+func TestTorrentAddFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libtorrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := libtorrent.NewConfig()
+	cfg.BindAddr = ":0"
+	s, err := libtorrent.NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	m := NewServer(s, dir)
+
+	info, err := bencode.Marshal(metainfo.Info{Name: "a", PieceLength: 16 * 1024, Length: 1, Pieces: make([]byte, 20)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = (&metainfo.MetaInfo{InfoBytes: info}).Write(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "a.torrent")
+	err = ioutil.WriteFile(file, buf.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	web := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+	defer web.Close()
+
+	download := filepath.Join(dir, "download")
+	res, a := call(t, m, "torrent-add", map[string]interface{}{"filename": file, "download-dir": download, "paused": true})
+	if res != "success" || a["torrent-added"] == nil {
+		t.Fatal(res, a)
+	}
+	if p := s.TorrentPath(s.Torrents()[0]); p != download {
+		t.Error(p)
+	}
+	for _, f := range []string{file, web.URL + "/a.torrent"} {
+		res, a = call(t, m, "torrent-add", map[string]interface{}{"filename": f, "paused": true})
+		if res != "success" || a["torrent-duplicate"] == nil {
+			t.Error(f, res, a)
+		}
+	}
+}
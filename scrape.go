@@ -0,0 +1,257 @@
+package libtorrent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+var ScrapeInterval = (30 * time.Minute).Nanoseconds() // active torrents scrape period
+var ScrapeTimeout = 15 * time.Second
+
+var ErrScrapeNotSupported = errors.New("scrape not supported")
+
+// last scrape results per tracker url
+type scrapeInfo struct {
+	running bool
+	last    int64 // nanoseconds
+	err     string
+
+	Seeders    int
+	Leechers   int
+	Downloaded int
+}
+
+// TorrentScrape
+//
+// Scrape all torrent trackers now, in background. Results available from
+// TorrentTrackers(), torrent does not need to be started.
+//
+//export TorrentScrape
+func TorrentScrape(i int) {
+	defaultSession.TorrentScrape(i)
+}
+
+func (s *Session) TorrentScrape(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+	s.scrapeTorrent(t, true)
+}
+
+// scrape active torrents which last scrape is older then ScrapeInterval. lock outside.
+func (s *Session) scrapeUpdate() {
+	if s.pause != nil { // no network while paused
+		return
+	}
+	for t := range s.active {
+		s.scrapeTorrent(t, false)
+	}
+}
+
+// lock outside
+func (s *Session) scrapeTorrent(t *torrent.Torrent, force bool) {
+	fs := s.filestorage[t.InfoHash()]
+	now := time.Now().UnixNano()
+	for _, tier := range t.AnnounceList() {
+		for _, u := range tier {
+			if !scrapeSupported(u) {
+				continue
+			}
+			if fs.scrapes == nil {
+				fs.scrapes = make(map[string]*scrapeInfo)
+			}
+			si := fs.scrapes[u]
+			if si == nil {
+				si = &scrapeInfo{}
+				fs.scrapes[u] = si
+			}
+			if si.running || (!force && now-si.last < ScrapeInterval) {
+				continue
+			}
+			si.running = true
+			go s.scrape(t, fs, u)
+		}
+	}
+}
+
+func (s *Session) scrape(t *torrent.Torrent, fs *fileStorage, u string) {
+	r, err := scrapeTracker(u, t.InfoHash())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	si := fs.scrapes[u]
+	if si == nil { // tracker removed
+		return
+	}
+	si.running = false
+	si.last = time.Now().UnixNano()
+	if err != nil {
+		si.err = err.Error() // reported by TorrentTrackers(), not an announce error
+		return
+	}
+	si.err = ""
+	si.Seeders = r.Seeders
+	si.Leechers = r.Leechers
+	si.Downloaded = r.Downloaded
+}
+
+func scrapeSupported(u string) bool {
+	_, err := scrapeURL(u)
+	return err == nil
+}
+
+// announce url to scrape url, BEP 48
+func scrapeURL(u string) (*url.URL, error) {
+	p, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	switch p.Scheme {
+	case "udp":
+		return p, nil
+	case "http", "https":
+		k := strings.LastIndex(p.Path, "/")
+		if k == -1 || !strings.HasPrefix(p.Path[k+1:], "announce") {
+			return nil, ErrScrapeNotSupported
+		}
+		p.Path = p.Path[:k+1] + "scrape" + strings.TrimPrefix(p.Path[k+1:], "announce")
+		return p, nil
+	}
+	return nil, ErrScrapeNotSupported
+}
+
+func scrapeTracker(u string, hash metainfo.Hash) (*scrapeInfo, error) {
+	p, err := scrapeURL(u)
+	if err != nil {
+		return nil, err
+	}
+	if p.Scheme == "udp" {
+		return scrapeUDP(p.Host, hash)
+	}
+	return scrapeHTTP(p, hash)
+}
+
+func scrapeHTTP(p *url.URL, hash metainfo.Hash) (*scrapeInfo, error) {
+	q := p.Query()
+	q.Set("info_hash", string(hash.Bytes()))
+	p.RawQuery = q.Encode()
+
+	c := http.Client{Timeout: ScrapeTimeout}
+	resp, err := c.Get(p.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, err
+	}
+	var r struct {
+		Files map[string]struct {
+			Complete   int `bencode:"complete"`
+			Downloaded int `bencode:"downloaded"`
+			Incomplete int `bencode:"incomplete"`
+		} `bencode:"files"`
+		FailureReason string `bencode:"failure reason"`
+	}
+	err = bencode.Unmarshal(buf.Bytes(), &r)
+	if err != nil {
+		return nil, err
+	}
+	if r.FailureReason != "" {
+		return nil, errors.New(r.FailureReason)
+	}
+	f, ok := r.Files[string(hash.Bytes())]
+	if !ok {
+		return nil, errors.New("torrent not found")
+	}
+	return &scrapeInfo{Seeders: f.Complete, Leechers: f.Incomplete, Downloaded: f.Downloaded}, nil
+}
+
+// BEP 15, connect then scrape
+func scrapeUDP(host string, hash metainfo.Hash) (*scrapeInfo, error) {
+	c, err := net.DialTimeout("udp", host, ScrapeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(ScrapeTimeout))
+
+	b, err := udpRequest(c, 0x41727101980, udpConnect, nil, 8) // protocol id
+	if err != nil {
+		return nil, err
+	}
+	id := binary.BigEndian.Uint64(b)
+
+	b, err = udpRequest(c, id, udpScrape, hash.Bytes(), 12)
+	if err != nil {
+		return nil, err
+	}
+	return &scrapeInfo{
+		Seeders:    int(binary.BigEndian.Uint32(b[0:4])),
+		Downloaded: int(binary.BigEndian.Uint32(b[4:8])),
+		Leechers:   int(binary.BigEndian.Uint32(b[8:12])),
+	}, nil
+}
+
+const (
+	udpConnect = 0
+	udpScrape  = 2
+	udpError   = 3
+)
+
+// send udp tracker request, return first 'n' bytes of response body
+func udpRequest(c net.Conn, id uint64, action uint32, body []byte, n int) ([]byte, error) {
+	tid := rand.Uint32()
+	var req bytes.Buffer
+	binary.Write(&req, binary.BigEndian, id)
+	binary.Write(&req, binary.BigEndian, action)
+	binary.Write(&req, binary.BigEndian, tid)
+	req.Write(body)
+	_, err := c.Write(req.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 2048)
+	for {
+		l, err := c.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if l < 8 || binary.BigEndian.Uint32(buf[4:8]) != tid { // not ours
+			continue
+		}
+		return udpResponse(buf[:l], action, n)
+	}
+}
+
+func udpResponse(buf []byte, action uint32, n int) ([]byte, error) {
+	switch binary.BigEndian.Uint32(buf[0:4]) {
+	case udpError:
+		return nil, errors.New(string(buf[8:]))
+	case action:
+		if len(buf) >= 8+n {
+			return buf[8 : 8+n], nil
+		}
+	}
+	return nil, errors.New("bad tracker response")
+}
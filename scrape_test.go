@@ -0,0 +1,41 @@
+package libtorrent
+
+import (
+	"testing"
+)
+
+func TestScrapeURL(t *testing.T) {
+	for u, s := range map[string]string{
+		"http://example.com/announce":           "http://example.com/scrape",
+		"http://example.com/x/announce.php?k=1": "http://example.com/x/scrape.php?k=1",
+		"udp://example.com:80":                  "udp://example.com:80",
+		"http://example.com/a":                  "",
+		"wss://example.com/announce":            "",
+	} {
+		p, err := scrapeURL(u)
+		if s == "" {
+			if err == nil {
+				t.Error(u, p)
+			}
+			continue
+		}
+		if err != nil || p.String() != s {
+			t.Error(u, p, err)
+		}
+	}
+}
+
+func TestUDPResponse(t *testing.T) {
+	b, err := udpResponse([]byte("\x00\x00\x00\x02tttt\x00\x00\x00\x01\x00\x00\x00\x02\x00\x00\x00\x03"), udpScrape, 12)
+	if err != nil || len(b) != 12 || b[3] != 1 || b[11] != 3 {
+		t.Error(b, err)
+	}
+	_, err = udpResponse([]byte("\x00\x00\x00\x03ttttbad hash"), udpScrape, 12)
+	if err == nil || err.Error() != "bad hash" {
+		t.Error(err)
+	}
+	_, err = udpResponse([]byte("\x00\x00\x00\x02tttt\x00"), udpScrape, 12)
+	if err == nil {
+		t.Error("short response")
+	}
+}
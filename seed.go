@@ -0,0 +1,211 @@
+package libtorrent
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// action on seed limit reached
+const (
+	SeedActionDefault    int32 = 0 // per torrent only, use session action
+	SeedActionPause      int32 = 1
+	SeedActionRemove     int32 = 2
+	SeedActionRemoveData int32 = 3
+)
+
+// SeedLimits
+//
+// Per torrent seeding goals. Ratio / Time: 0 - use session value (Config),
+// -1 - unlimited. Time in nanoseconds.
+type SeedLimits struct {
+	Ratio  float64
+	Time   int64
+	Action int32
+}
+
+//export TorrentSetSeedLimits
+func TorrentSetSeedLimits(i int, ratio float64, seedTime int64, action int32) bool {
+	return defaultSession.TorrentSetSeedLimits(i, ratio, seedTime, action)
+}
+
+func (s *Session) TorrentSetSeedLimits(i int, ratio float64, seedTime int64, action int32) bool {
+	err := s.TorrentSetSeedLimitsE(i, ratio, seedTime, action)
+	s.setError(err)
+	return err == nil
+}
+
+func TorrentSetSeedLimitsE(i int, ratio float64, seedTime int64, action int32) error {
+	return defaultSession.TorrentSetSeedLimitsE(i, ratio, seedTime, action)
+}
+
+func (s *Session) TorrentSetSeedLimitsE(i int, ratio float64, seedTime int64, action int32) error {
+	switch action {
+	case SeedActionDefault, SeedActionPause, SeedActionRemove, SeedActionRemoveData:
+	default:
+		return ErrSeedAction
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return err
+	}
+	fs := s.filestorage[t.InfoHash()]
+	fs.SeedRatio = ratio
+	fs.SeedTime = seedTime
+	fs.SeedAction = action
+	s.stateChanged(t)
+	return nil
+}
+
+//export TorrentSeedLimits
+func TorrentSeedLimits(i int) *SeedLimits {
+	return defaultSession.TorrentSeedLimits(i)
+}
+
+func (s *Session) TorrentSeedLimits(i int) *SeedLimits {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return nil
+	}
+	fs := s.filestorage[t.InfoHash()]
+	return &SeedLimits{fs.SeedRatio, fs.SeedTime, fs.SeedAction}
+}
+
+// effective torrent limits, session values applied
+func (s *Session) seedLimits(t *torrent.Torrent) *SeedLimits {
+	fs := s.filestorage[t.InfoHash()]
+	l := &SeedLimits{fs.SeedRatio, fs.SeedTime, fs.SeedAction}
+	if l.Ratio == 0 {
+		l.Ratio = s.cfg.SeedRatio
+	}
+	if l.Time == 0 {
+		l.Time = s.cfg.SeedTime
+	}
+	if l.Action == SeedActionDefault {
+		l.Action = s.cfg.SeedAction
+	}
+	return l
+}
+
+func (l *SeedLimits) enabled() bool {
+	return l.Ratio > 0 || l.Time > 0
+}
+
+// check seed goals of all seeding torrents, called every second by ratesEngine
+func (s *Session) seedUpdate() {
+	var seeds []*torrent.Torrent
+	for t := range s.active {
+		if s.seedLimits(t).enabled() && s.pendingCompleted(t) {
+			seeds = append(seeds, t)
+		}
+	}
+	for _, t := range seeds { // seedLimit() changes 's.active'
+		s.seedLimit(t)
+	}
+}
+
+// check seeding torrent limits and apply action. return true if torrent been
+// stopped or removed.
+func (s *Session) seedLimit(t *torrent.Torrent) bool {
+	l := s.seedLimits(t)
+	if !l.enabled() {
+		return false
+	}
+
+	fs := s.filestorage[t.InfoHash()]
+
+	reached := false
+
+	if l.Ratio > 0 {
+		stats := t.Stats()
+		down := stats.BytesRead.Int64()
+		if down == 0 { // seeding own files, ratio by torrent size
+			down = t.Length()
+		}
+		if down > 0 && float64(stats.BytesWritten.Int64())/float64(down) >= l.Ratio {
+			reached = true
+		}
+	}
+
+	if l.Time > 0 {
+		seeding := fs.SeedingTime
+		if _, ok := s.active[t]; ok {
+			seeding = seeding + (time.Now().UnixNano() - fs.ActivateDate)
+		}
+		if seeding >= l.Time {
+			reached = true
+		}
+	}
+
+	if !reached {
+		return false
+	}
+
+	i := s.torrentIndex(t)
+
+	switch l.Action {
+	case SeedActionRemove, SeedActionRemoveData:
+		s.stopTorrent(t)
+		if l.Action == SeedActionRemoveData {
+			err := s.torrentDeleteData(t)
+			if err != nil {
+				s.eventError(t, err)
+			}
+		}
+		if i != -1 {
+			s.unregister(i)
+		}
+	default:
+		s.stopTorrent(t)
+	}
+
+	if s.pause == nil {
+		s.queueNext(nil)
+	}
+
+	s.eventStatus()
+
+	return true
+}
+
+// delete all torrent files from disk / external storage
+func (s *Session) torrentDeleteData(t *torrent.Torrent) error {
+	if t.Info() == nil {
+		return nil
+	}
+
+	hash := t.InfoHash()
+
+	s.torrentstorageLock.Lock()
+	defer s.torrentstorageLock.Unlock()
+	ts := s.torrentstorage[hash]
+
+	var removed []string
+
+	for i, fi := range ts.info.UpvertedFiles() {
+		rel := ts.fileRel(i, fi)
+		if s.storageExternal != nil {
+			err := s.storageExternal.Remove(hash.HexString(), rel)
+			if err != nil {
+				return err
+			}
+		} else {
+			p := filepath.Join(ts.path, rel)
+			err := os.Remove(p)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			removed = append(removed, p)
+		}
+	}
+
+	removeEmptyDirs(ts.path, removed)
+
+	return nil
+}
@@ -0,0 +1,15 @@
+package libtorrent
+
+import (
+	"testing"
+)
+
+func TestSeedLimitsAction(t *testing.T) {
+	s := newSession(NewConfig())
+	if err := s.TorrentSetSeedLimitsE(7, 1, 0, 4); err != ErrSeedAction {
+		t.Error(err)
+	}
+	if err := s.TorrentSetSeedLimitsE(7, 1, 0, SeedActionRemove); err != ErrUnknownTorrent {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,841 @@
+package libtorrent
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/missinggo"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Session
+//
+// Isolated torrent client with own torrents list, queue, storage, LPD and port
+// mapping. Package level functions work over default session created by
+// Create().
+type Session struct {
+	cfg *Config
+
+	mu  sync.Mutex
+	err error
+
+	clientConfig *torrent.ClientConfig
+	client       *torrent.Client
+	clientAddr   string
+
+	torrents map[int]*torrent.Torrent
+	index    int
+	active   map[*torrent.Torrent]int64
+	queue    map[*torrent.Torrent]int64
+	pause    map[*torrent.Torrent]int32
+	forced   map[*torrent.Torrent]bool  // ForceStartTorrent, out of active limits
+	status   map[*torrent.Torrent]int32 // last reported status, for OnStatusChanged
+	rates    map[*torrent.Torrent]*torrentRate
+	rate     transferRate // session totals
+
+	uploadLimited int // ClientConfig.UploadRateLimiter rate, see uploadLimit()
+
+	filestorage        map[metainfo.Hash]*fileStorage
+	storageExternal    FileStorageTorrent
+	torrentstorage     map[metainfo.Hash]*torrentStorage
+	torrentstorageLock sync.Mutex
+	webseedstorage     map[metainfo.Hash]*webSeeds
+
+	lpd *LPDServer
+
+	tcpPort      string
+	udpPort      string
+	mappingAddr  []string // clientAddr when mapping called
+	clientPorts  []string
+	mappingClose missinggo.Event
+
+	listener   EventListener
+	events     []func(l EventListener)
+	eventsWake chan struct{}
+	eventsLock sync.Mutex
+
+	announceList  [][]string
+	announceKey   int32 // TorrentReannounce() key, same for all torrents
+	metainfoBuild *metainfoBuilder
+
+	httpServer   *http.Server // StartHTTPServer
+	httpListener net.Listener
+
+	autosaveLock    sync.Mutex
+	autosaveDir     string // last written session file, skip unchanged
+	autosaveSession []byte
+}
+
+var defaultSession = newSession(nil)
+
+func newSession(cfg *Config) *Session {
+	return &Session{cfg: cfg, announceList: builtinAnnounceList, announceKey: rand.Int31()}
+}
+
+// NewSession
+//
+// Create and start new torrent client. nil cfg means NewConfig().
+func NewSession(cfg *Config) (*Session, error) {
+	if cfg == nil {
+		cfg = NewConfig()
+	}
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	cfg = cfg.copy()
+	s := newSession(cfg)
+	if !s.create() {
+		return nil, s.err
+	}
+	return s, nil
+}
+
+// DefaultSession
+//
+// Session used by package level functions.
+func DefaultSession() *Session {
+	return defaultSession
+}
+
+func (s *Session) SetDefaultAnnouncesList(str string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.announceList = nil
+	for _, a := range strings.Split(str, "\n") {
+		s.announceList = append(s.announceList, []string{a})
+	}
+}
+
+func (s *Session) SetUploadRate(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg.UploadRate = i
+	s.uploadLimitUpdate()
+}
+
+func (s *Session) SetDownloadRate(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg.DownloadRate = i
+	s.client.Config(func() { s.clientConfig.DownloadRateLimiter = limit(i) })
+}
+
+func (s *Session) CreateTorrentFileFromMetaInfo() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createTorrentFileFromMetaInfo()
+}
+
+func (s *Session) createTorrentFileFromMetaInfo() []byte {
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	s.err = s.metainfoBuild.metainfo.Write(w)
+	if s.err != nil {
+		return nil
+	}
+	s.err = w.Flush()
+	if s.err != nil {
+		return nil
+	}
+	return b.Bytes()
+}
+
+func (s *Session) CreateTorrentFile(root string) []byte {
+	n := s.CreateMetainfoBuilder(&defaultMetainfoBuilder{root: root})
+	for i := 0; i < n; i++ {
+		s.HashMetaInfo(i)
+	}
+	buf := s.CreateTorrentFileFromMetaInfo()
+	s.CloseMetaInfo()
+	return buf
+}
+
+func (s *Session) create() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.torrents = make(map[int]*torrent.Torrent)
+	s.filestorage = make(map[metainfo.Hash]*fileStorage)
+	s.torrentstorage = make(map[metainfo.Hash]*torrentStorage)
+	s.queue = make(map[*torrent.Torrent]int64)
+	s.active = make(map[*torrent.Torrent]int64)
+	s.forced = make(map[*torrent.Torrent]bool)
+	s.status = make(map[*torrent.Torrent]int32)
+	s.rates = make(map[*torrent.Torrent]*torrentRate)
+	s.rate = transferRate{}
+	s.webseedstorage = make(map[metainfo.Hash]*webSeeds)
+	s.pause = nil
+	s.index = 0
+	s.tcpPort = ""
+	s.udpPort = ""
+	s.mappingAddr = nil
+
+	s.clientConfig = torrent.NewDefaultClientConfig()
+	s.clientConfig.DefaultStorage = &torrentOpener{s}
+	s.clientConfig.Seed = true
+	s.clientConfig.NoUpload = false
+	s.clientConfig.DisableAggressiveUpload = true
+	s.clientConfig.SetListenAddr(s.cfg.BindAddr)
+	s.clientConfig.UploadRateLimiter = limit(s.cfg.UploadRate)
+	s.uploadLimited = s.cfg.UploadRate
+	s.clientConfig.DownloadRateLimiter = limit(s.cfg.DownloadRate)
+	if s.cfg.Version != "" {
+		s.clientConfig.ExtendedHandshakeClientVersion = s.cfg.Version
+	}
+	s.clientConfig.HalfOpenConnsPerTorrent = s.cfg.SocketsPerTorrent
+	s.clientConfig.TorrentPeersLowWater = 2 * s.clientConfig.HalfOpenConnsPerTorrent
+	s.clientConfig.EstablishedConnsPerTorrent = s.clientConfig.TorrentPeersLowWater
+	if s.cfg.Bep20 != "" {
+		s.clientConfig.Bep20 = s.cfg.Bep20
+	}
+
+	s.client, s.err = torrent.NewClient(s.clientConfig)
+	if s.err != nil {
+		return false
+	}
+
+	s.lpdStart()
+
+	// when create client do 1 second discovery
+	s.mu.Unlock()
+	s.mappingPort(1 * time.Second)
+	s.mu.Lock()
+
+	s.err = s.client.Start()
+	if s.err != nil {
+		return false
+	}
+	s.clientAddr = s.listenAddr()
+
+	go func() {
+		s.mappingStart()
+	}()
+
+	go s.ratesEngine()
+
+	go s.trackersEngine()
+
+	go s.autosaveEngine()
+
+	return true
+}
+
+type BytesInfo struct {
+	Downloaded int64
+	Uploaded   int64
+	// bytes per second, 5 seconds average
+	DownloadRate int64
+	UploadRate   int64
+}
+
+func (s *Session) Stats() *BytesInfo {
+	stats := s.client.Stats()
+	s.mu.Lock()
+	r := s.rate.rates(RateWindowMedium)
+	s.mu.Unlock()
+	return &BytesInfo{stats.BytesRead.Int64(), stats.BytesWritten.Int64(), int64(r.Download), int64(r.Upload)}
+}
+
+func (s *Session) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.torrents)
+}
+
+func (s *Session) Torrents() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ii []int
+	for i := range s.torrents {
+		ii = append(ii, i)
+	}
+	sort.Ints(ii)
+	return ii
+}
+
+func (s *Session) ListenAddr() string {
+	return s.listenAddr()
+}
+
+func (s *Session) listenAddr() string {
+	return fmt.Sprintf(":%d", s.client.LocalPort())
+}
+
+func (s *Session) CreateTorrentFromMetaInfo() int {
+	i, err := s.CreateTorrentFromMetaInfoE()
+	s.setError(err)
+	return i
+}
+
+func (s *Session) CreateTorrentFromMetaInfoE() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := s.metainfoBuild.metainfo.HashInfoBytes()
+
+	if _, ok := s.filestorage[hash]; ok {
+		return -1, ErrAlreadyExists
+	}
+
+	fs := s.registerFileStorage(hash, s.metainfoBuild.b.Root())
+
+	fs.Comment = s.metainfoBuild.metainfo.Comment
+	fs.Creator = s.metainfoBuild.metainfo.CreatedBy
+	fs.CreatedOn = (time.Duration(s.metainfoBuild.metainfo.CreationDate) * time.Second).Nanoseconds()
+
+	t, err := s.client.AddTorrent(s.metainfoBuild.metainfo)
+	if err != nil {
+		return -1, err
+	}
+
+	s.fileUpdateCheck(t)
+
+	return s.register(t), nil
+}
+
+func (s *Session) AddMagnet(path string, magnet string) int {
+	i, err := s.AddMagnetE(path, magnet)
+	s.setError(err)
+	return i
+}
+
+func (s *Session) AddMagnetE(path string, magnet string) (int, error) {
+	spec, err := torrent.TorrentSpecFromMagnetURI(magnet)
+	if err != nil {
+		return -1, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.filestorage[spec.InfoHash]; ok {
+		return -1, ErrAlreadyExists
+	}
+
+	s.registerFileStorage(spec.InfoHash, path)
+
+	t, _, err := s.client.AddTorrentSpec(spec)
+	if err != nil {
+		return -1, err
+	}
+
+	return s.register(t), nil
+}
+
+func (s *Session) AddTorrentFromURL(path string, url string) int {
+	i, err := s.AddTorrentFromURLE(path, url)
+	s.setError(err)
+	return i
+}
+
+func (s *Session) AddTorrentFromURLE(path string, url string) (int, error) {
+	resp, err := http.Get(url) // do not hold lock during network fetch
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+
+	mi, err := metainfo.Load(resp.Body)
+	if err != nil {
+		return -1, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addTorrent(path, mi)
+}
+
+func (s *Session) AddTorrent(file string) int {
+	i, err := s.AddTorrentE(file)
+	s.setError(err)
+	return i
+}
+
+func (s *Session) AddTorrentE(file string) (int, error) {
+	mi, err := metainfo.LoadFromFile(file)
+	if err != nil {
+		return -1, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addTorrent(path.Dir(file), mi)
+}
+
+func (s *Session) AddTorrentFromBytes(path string, buf []byte) int {
+	i, err := s.AddTorrentFromBytesE(path, buf)
+	s.setError(err)
+	return i
+}
+
+func (s *Session) AddTorrentFromBytesE(path string, buf []byte) (int, error) {
+	mi, err := metainfo.Load(bytes.NewReader(buf))
+	if err != nil {
+		return -1, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addTorrent(path, mi)
+}
+
+func (s *Session) addTorrent(path string, mi *metainfo.MetaInfo) (int, error) {
+	hash := mi.HashInfoBytes()
+
+	if _, ok := s.filestorage[hash]; ok {
+		return -1, ErrAlreadyExists
+	}
+
+	fs := s.registerFileStorage(hash, path)
+
+	fs.Comment = mi.Comment
+	fs.Creator = mi.CreatedBy
+	fs.CreatedOn = (time.Duration(mi.CreationDate) * time.Second).Nanoseconds()
+	for _, u := range mi.UrlList {
+		fs.UrlList = append(fs.UrlList, WebSeedUrl{Url: u})
+	}
+
+	t, err := s.client.AddTorrent(mi)
+	if err != nil {
+		return -1, err
+	}
+
+	s.fileUpdateCheck(t)
+
+	return s.register(t), nil
+}
+
+func (s *Session) GetTorrent(i int) []byte {
+	buf, err := s.GetTorrentE(i)
+	s.setError(err)
+	return buf
+}
+
+func (s *Session) GetTorrentE(i int) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return nil, err
+	}
+	if t.Info() == nil {
+		return nil, ErrNoMetadata
+	}
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	err = t.Metainfo().Write(w)
+	if err != nil {
+		return nil, err
+	}
+	err = w.Flush()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *Session) StartTorrent(i int) bool {
+	err := s.StartTorrentE(i)
+	s.setError(err)
+	return err == nil
+}
+
+func (s *Session) StartTorrentE(i int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer s.eventStatus()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return err
+	}
+
+	if s.pause != nil {
+		s.pause[t] = StatusDownloading
+		return nil
+	}
+
+	if s.forced[t] { // turn forced torrent into regular one, it now takes slot
+		delete(s.forced, t)
+		if _, ok := s.active[t]; ok && !s.slotFree(t, nil) {
+			s.stopTorrent(t) // no free slot, compete for one as stopped torrent
+		}
+	}
+
+	if _, ok := s.active[t]; ok {
+		return nil
+	}
+
+	if !s.slotFree(t, nil) {
+		// priority to start, seeding torrent will not start over downloading torrents
+		return s.queueStart(t)
+	}
+
+	return s.startTorrent(t)
+}
+
+func (s *Session) startTorrent(t *torrent.Torrent) error {
+	fs := s.filestorage[t.InfoHash()]
+
+	s.torrentstorageLock.Lock()
+	moving := s.torrentstorage[t.InfoHash()].moving
+	s.torrentstorageLock.Unlock()
+	if moving != nil {
+		return ErrMoving
+	}
+
+	err := s.client.StartTorrent(t)
+	if err != nil {
+		return err
+	}
+
+	s.active[t] = time.Now().UnixNano()
+
+	s.lpdPeers(t)
+
+	s.lpdForce()
+
+	fs.ActivateDate = time.Now().UnixNano() // activate time now
+
+	go func() {
+		select {
+		case <-t.GotInfo():
+		case <-t.Wait():
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// update time between start and GotInfo
+		now := time.Now().UnixNano()
+		if s.pendingCompleted(t) { // seeding
+			fs.SeedingTime = fs.SeedingTime + (now - fs.ActivateDate)
+		} else { // downloading
+			fs.DownloadingTime = fs.DownloadingTime + (now - fs.ActivateDate)
+		}
+		fs.ActivateDate = now
+
+		s.eventMetadata(t)
+
+		s.fileUpdateCheck(t)
+	}()
+
+	go func() {
+		s.queueEngine(t)
+	}()
+
+	s.eventStatus()
+
+	return nil
+}
+
+func (s *Session) DownloadMetadata(i int) bool {
+	err := s.DownloadMetadataE(i)
+	s.setError(err)
+	return err == nil
+}
+
+func (s *Session) DownloadMetadataE(i int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return err
+	}
+	fs := s.filestorage[t.InfoHash()]
+
+	if _, ok := s.active[t]; ok {
+		return nil
+	}
+
+	err = s.client.StartTorrent(t)
+	if err != nil {
+		return err
+	}
+
+	fs.ActivateDate = time.Now().UnixNano()
+
+	go func() {
+		select {
+		case <-t.GotInfo():
+		case <-t.Wait():
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		now := time.Now().UnixNano()
+		if s.pendingCompleted(t) { // seeding
+			fs.SeedingTime = fs.SeedingTime + (now - fs.ActivateDate)
+		} else { // downloading
+			fs.DownloadingTime = fs.DownloadingTime + (now - fs.ActivateDate)
+		}
+		fs.ActivateDate = now
+
+		s.eventMetadata(t)
+
+		s.fileUpdateCheck(t)
+		t.Drop()
+	}()
+
+	return nil
+}
+
+func (s *Session) MetaTorrent(i int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return false
+	}
+	return t.Info() != nil
+}
+
+func (s *Session) StopTorrent(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+
+	defer s.eventStatus()
+
+	defer delete(s.queue, t) // delete queued torrent from queue (seeded will be removed by queueEngine)
+
+	if s.stopTorrent(t) { // we sholuld not call queueNext on suspend torrent, otherwise it overlap ActiveTorrent
+		if s.pause != nil {
+			return
+		}
+		s.queueNext(nil)
+	}
+}
+
+func (s *Session) stopTorrent(t *torrent.Torrent) bool {
+	if s.pause != nil {
+		delete(s.pause, t)
+	}
+
+	delete(s.forced, t)
+
+	info := t.InfoHash()
+
+	fs := s.filestorage[info]
+
+	s.webSeedStop(t)
+
+	if _, ok := s.active[t]; ok {
+		seeding := s.pendingCompleted(t)
+		t.Drop()
+		now := time.Now().UnixNano()
+		if seeding {
+			fs.SeedingTime = fs.SeedingTime + (now - fs.ActivateDate)
+		} else {
+			fs.DownloadingTime = fs.DownloadingTime + (now - fs.ActivateDate)
+		}
+		fs.ActivateDate = now
+		delete(s.active, t)
+		return true
+	} else {
+		t.Stop()
+		return false
+	}
+}
+
+func (s *Session) CheckTorrent(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[t.InfoHash()]
+	ts.completedPieces.Clear()
+	ts.completed = false
+	s.torrentstorageLock.Unlock()
+
+	fb := s.filePendingBitmap(t.InfoHash())
+
+	s.client.CheckTorrent(t, fb)
+}
+
+func (s *Session) RemoveTorrent(i int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+
+	s.stopTorrent(t)
+
+	s.unregister(i)
+}
+
+func (s *Session) RemoveTorrentData(i int) bool {
+	err := s.RemoveTorrentDataE(i)
+	s.setError(err)
+	return err == nil
+}
+
+// torrent removed even if some files can't be deleted
+func (s *Session) RemoveTorrentDataE(i int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return err
+	}
+
+	s.stopTorrent(t)
+
+	err = s.torrentDeleteData(t)
+
+	s.unregister(i)
+
+	return err
+}
+
+func (s *Session) WaitAll() bool {
+	s.mu.Lock()
+	c := s.client
+	if c == nil {
+		s.mu.Unlock()
+		return true
+	}
+	s.mu.Unlock()
+	return c.WaitAll()
+}
+
+func (s *Session) Error() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err.Error()
+	}
+	return ""
+}
+
+// keep last error for Error() call, old style api
+func (s *Session) setError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *Session) Close() {
+	s.autosave(true)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mappingStop()
+
+	s.lpdStop()
+
+	s.httpStop()
+
+	s.clientAddr = ""
+
+	if s.client != nil {
+		s.client.Close()
+		s.client = nil
+	}
+
+	s.eventsStop()
+}
+
+//
+// protected
+//
+
+func (s *Session) lookup(i int) (*torrent.Torrent, error) {
+	t, ok := s.torrents[i]
+	if !ok {
+		return nil, ErrUnknownTorrent
+	}
+	return t, nil
+}
+
+func (s *Session) register(t *torrent.Torrent) int {
+	s.index++
+	for s.torrents[s.index] != nil {
+		s.index++
+	}
+	s.torrents[s.index] = t
+
+	t.SetMaxConns(s.cfg.SocketsPerTorrent)
+
+	fs := s.filestorage[t.InfoHash()]
+	if fs.QueuePosition == 0 { // new torrent goes to the queue end
+		for _, m := range s.torrents {
+			if m == t {
+				continue
+			}
+			if p := s.filestorage[m.InfoHash()].QueuePosition; p >= fs.QueuePosition {
+				fs.QueuePosition = p + 1
+			}
+		}
+	}
+
+	s.status[t] = s.torrentStatus(t)
+
+	s.stateChanged(t)
+
+	return s.index
+}
+
+func (s *Session) unregister(i int) {
+	t := s.torrents[i]
+
+	info := t.InfoHash()
+
+	delete(s.filestorage, info)
+
+	s.torrentstorageLock.Lock()
+	delete(s.torrentstorage, info)
+	s.torrentstorageLock.Unlock()
+
+	delete(s.active, t)
+
+	delete(s.queue, t)
+
+	delete(s.pause, t)
+
+	delete(s.forced, t)
+
+	delete(s.status, t)
+
+	delete(s.torrents, i)
+}
@@ -0,0 +1,296 @@
+package libtorrent
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent"
+)
+
+// session file name inside SaveSession() folder, torrents saved as <hash>.state
+const sessionStateFile = "session.json"
+const torrentStateExt = ".state"
+
+type SessionState struct {
+	Version int `json:"version"`
+
+	// rate limits, bytes per second
+	UploadRate   int `json:"upload_rate,omitempty"`
+	DownloadRate int `json:"download_rate,omitempty"`
+
+	// Pause() called
+	Paused bool `json:"paused,omitempty"`
+
+	// queue order, first to start goes first
+	Torrents []SessionTorrent `json:"torrents,omitempty"`
+}
+
+type SessionTorrent struct {
+	Hash   string `json:"hash"`
+	Status int32  `json:"status"` // StatusPaused, StatusDownloading, StatusQueued or StatusForced
+}
+
+// SaveSession
+//
+// Save all torrents states into 'dir' folder, one <hash>.state file per torrent
+// plus session file with rate limits, queue order and torrents statuses. Files
+// written atomically, states of removed torrents deleted.
+//
+//export SaveSession
+func SaveSession(dir string) bool {
+	return defaultSession.SaveSession(dir)
+}
+
+func (s *Session) SaveSession(dir string) bool {
+	err := s.SaveSessionE(dir)
+	s.setError(err)
+	return err == nil
+}
+
+func SaveSessionE(dir string) error {
+	return defaultSession.SaveSessionE(dir)
+}
+
+func (s *Session) SaveSessionE(dir string) error {
+	s.mu.Lock()
+	state, saves := s.sessionState(false, false)
+	s.mu.Unlock()
+	states, err := encodeStates(saves)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeSession(dir, buf, states, state)
+}
+
+// session state and torrents states by hash, only changed torrents if 'dirty'.
+// 'clear' resets dirty flags (autosave). lock outside.
+func (s *Session) sessionState(dirty bool, clear bool) (*SessionState, map[string]*torrentSave) {
+	state := &SessionState{Version: 1}
+	saves := make(map[string]*torrentSave)
+
+	state.UploadRate = s.cfg.UploadRate
+	state.DownloadRate = s.cfg.DownloadRate
+	state.Paused = s.pause != nil
+	for _, t := range s.queueOrder() {
+		hash := t.InfoHash().HexString()
+		state.Torrents = append(state.Torrents, SessionTorrent{hash, s.savedStatus(t)})
+
+		s.torrentstorageLock.Lock()
+		ts := s.torrentstorage[t.InfoHash()]
+		changed := ts.dirty
+		if clear {
+			ts.dirty = false
+		}
+		s.torrentstorageLock.Unlock()
+		if dirty && !changed {
+			continue
+		}
+
+		saves[hash] = s.saveTorrentState(t)
+	}
+	return state, saves
+}
+
+// encode torrents states returned by sessionState(), no lock needed
+func encodeStates(saves map[string]*torrentSave) (map[string][]byte, error) {
+	states := make(map[string][]byte)
+	for hash, m := range saves {
+		buf, err := m.encode()
+		if err != nil {
+			return nil, err
+		}
+		states[hash] = buf
+	}
+	return states, nil
+}
+
+// write torrents states and session file (if not nil), delete states of
+// torrents not in session
+func writeSession(dir string, buf []byte, states map[string][]byte, state *SessionState) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	for hash, b := range states {
+		err = writeFileAtomic(filepath.Join(dir, hash+torrentStateExt), b)
+		if err != nil {
+			return err
+		}
+	}
+	if buf == nil {
+		return nil
+	}
+	err = writeFileAtomic(filepath.Join(dir, sessionStateFile), buf)
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool)
+	for _, m := range state.Torrents {
+		keep[m.Hash] = true
+	}
+	ff, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range ff {
+		hash := strings.TrimSuffix(f.Name(), torrentStateExt)
+		if hash == f.Name() || !isHash(hash) {
+			continue
+		}
+		if !keep[hash] {
+			os.Remove(filepath.Join(dir, f.Name()))
+		}
+	}
+	return nil
+}
+
+// LoadSession
+//
+// Load torrents saved by SaveSession(), restore rate limits, queue order and
+// torrents statuses. Broken or missing torrent states skipped, first error
+// returned after rest torrents loaded.
+//
+//export LoadSession
+func LoadSession(dir string) bool {
+	return defaultSession.LoadSession(dir)
+}
+
+func (s *Session) LoadSession(dir string) bool {
+	err := s.LoadSessionE(dir)
+	s.setError(err)
+	return err == nil
+}
+
+func LoadSessionE(dir string) error {
+	return defaultSession.LoadSessionE(dir)
+}
+
+func (s *Session) LoadSessionE(dir string) error {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, sessionStateFile))
+	if err != nil {
+		return err
+	}
+	var state SessionState
+	err = json.Unmarshal(buf, &state)
+	if err != nil {
+		return err
+	}
+
+	var first error
+	states := make([]*TorrentState, len(state.Torrents))
+	stats := make([][]FileStat, len(state.Torrents))
+	for k, m := range state.Torrents { // read and stat files without lock
+		buf, err := ioutil.ReadFile(filepath.Join(dir, m.Hash+torrentStateExt))
+		if err == nil {
+			states[k], err = decodeTorrentState(buf)
+		}
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		stats[k] = s.stateFilePaths("", states[k]).stats()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer s.eventStatus()
+
+	statuses := make(map[*torrent.Torrent]int32)
+	for k, m := range state.Torrents {
+		if states[k] == nil {
+			continue
+		}
+		t, err := s.loadState("", states[k], stats[k])
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		s.register(t)
+		statuses[t] = m.Status
+	}
+
+	s.cfg.UploadRate = state.UploadRate
+	s.cfg.DownloadRate = state.DownloadRate
+	s.client.Config(func() { s.clientConfig.DownloadRateLimiter = limit(state.DownloadRate) })
+	s.uploadLimitUpdate()
+
+	if state.Paused || s.pause != nil {
+		if s.pause == nil {
+			s.pause = make(map[*torrent.Torrent]int32)
+		}
+		for t, status := range statuses {
+			if status != StatusPaused {
+				s.pause[t] = status
+			}
+		}
+		return first
+	}
+
+	s.resumeTorrents(statuses)
+
+	return first
+}
+
+// status to restore torrent with, paused session keeps statuses torrents had
+// before Pause(). lock outside.
+func (s *Session) savedStatus(t *torrent.Torrent) int32 {
+	status := s.torrentStatus(t)
+	if s.pause != nil {
+		if p, ok := s.pause[t]; ok {
+			status = p
+		}
+	}
+	switch status {
+	case StatusDownloading, StatusSeeding:
+		return StatusDownloading
+	case StatusQueued, StatusForced:
+		return status
+	default: // checking torrent is stopped after check
+		return StatusPaused
+	}
+}
+
+func isHash(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == 20
+}
+
+// write to temporary file in same folder and rename, so crash never leaves
+// half written file
+func writeFileAtomic(path string, buf []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	err = os.Rename(f.Name(), path)
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package libtorrent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libtorrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := filepath.Join(dir, "a.state")
+	for _, s := range []string{"first", "second"} {
+		err = writeFileAtomic(p, []byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, err := ioutil.ReadFile(p)
+		if err != nil || string(buf) != s {
+			t.Error(string(buf), err)
+		}
+	}
+	ff, _ := ioutil.ReadDir(dir)
+	if len(ff) != 1 { // no temporary files left
+		t.Error(len(ff))
+	}
+}
+
+func TestIsHash(t *testing.T) {
+	if !isHash("5bd07c7e8aa43a422f27beba9583e8065230afe9") || isHash("session") || isHash("5bd07c7e") {
+		t.Error("hash")
+	}
+}
@@ -2,7 +2,6 @@ package libtorrent
 
 import (
 	"encoding/json"
-	"errors"
 	"time"
 
 	"github.com/anacrolix/torrent"
@@ -16,44 +15,109 @@ import (
 // avoid this, and save machine time we need to store torrents runtime states
 // completed pieces and other information externaly.
 //
-// Save runtime torrent data to state file
+// Save runtime torrent data to state file. Binary format with checksum,
+// LoadTorrent() reads older JSON states too.
 //
 //export SaveTorrent
 func SaveTorrent(i int) []byte {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.SaveTorrent(i)
+}
 
-	t := torrents[i]
+func (s *Session) SaveTorrent(i int) []byte {
+	buf, err := s.SaveTorrentE(i)
+	s.setError(err)
+	return buf
+}
+
+func SaveTorrentE(i int) ([]byte, error) {
+	return defaultSession.SaveTorrentE(i)
+}
 
-	var buf []byte
+func (s *Session) SaveTorrentE(i int) ([]byte, error) {
+	s.mu.Lock()
 
-	buf, err = saveTorrentState(t)
+	t, err := s.lookup(i)
 	if err != nil {
-		return nil
+		s.mu.Unlock()
+		return nil, err
 	}
+	save := s.saveTorrentState(t)
+	s.mu.Unlock()
 
-	return buf
+	return save.encode()
+}
+
+// SaveTorrentTo
+//
+// Save runtime torrent data to 'path' file. File written atomically, crash
+// keeps old state.
+//
+//export SaveTorrentTo
+func SaveTorrentTo(i int, path string) bool {
+	return defaultSession.SaveTorrentTo(i, path)
+}
+
+func (s *Session) SaveTorrentTo(i int, path string) bool {
+	err := s.SaveTorrentToE(i, path)
+	s.setError(err)
+	return err == nil
+}
+
+func SaveTorrentToE(i int, path string) error {
+	return defaultSession.SaveTorrentToE(i, path)
+}
+
+func (s *Session) SaveTorrentToE(i int, path string) error {
+	buf, err := s.SaveTorrentE(i)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf)
 }
 
 // LoadTorrent
 //
-// Load runtime torrent data from saved state file
+// Load runtime torrent data from saved state file. Empty path means download
+// folder saved in state. Pieces of files changed since SaveTorrent() (size or
+// modification time) are cleared and rechecked in background.
 //
 //export LoadTorrent
 func LoadTorrent(path string, buf []byte) int {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.LoadTorrent(path, buf)
+}
+
+func (s *Session) LoadTorrent(path string, buf []byte) int {
+	i, err := s.LoadTorrentE(path, buf)
+	s.setError(err)
+	return i
+}
+
+func LoadTorrentE(path string, buf []byte) (int, error) {
+	return defaultSession.LoadTorrentE(path, buf)
+}
+
+func (s *Session) LoadTorrentE(path string, buf []byte) (int, error) {
+	state, err := decodeTorrentState(buf)
+	if err != nil {
+		return -1, err
+	}
+	stats := s.stateFilePaths(path, state).stats()
 
-	var t *torrent.Torrent
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	t, err = loadTorrentState(path, buf)
+	t, err := s.loadState(path, state, stats)
 	if err != nil {
-		return -1
+		return -1, err
 	}
 
-	return register(t)
+	return s.register(t), nil
 }
 
+// current TorrentState version, saved binary (see encodeState()). versions
+// 1..4 are json.
+const stateVersion = 5
+
 type TorrentState struct {
 	Version int `json:"version"`
 
@@ -65,9 +129,18 @@ type TorrentState struct {
 	MetaInfo *metainfo.MetaInfo `json:"metainfo,omitempty"`
 	Pieces   []bool             `json:"pieces,omitempty"`
 
-	Root string `json:root,omitempty`
+	Root string `json:"root,omitempty"`
+
+	// download folder, LoadTorrent() uses it when called with empty path
+	Path string `json:"path,omitempty"`
+
+	// renamed files, file index -> path inside torrent folder
+	Renames map[int]string `json:"renames,omitempty"`
 
-	Checks []bool `json:"checks,omitempty"`
+	Checks []bool `json:"checks,omitempty"` // checked files, for old readers. Priorities used on load
+
+	// FilePriority* per file
+	Priorities []int32 `json:"priorities,omitempty"`
 
 	// Stats bytes
 	Downloaded int64 `json:"downloaded,omitempty"`
@@ -87,33 +160,62 @@ type TorrentState struct {
 	CreatedOn int64  `json:"created_on,omitempty"`
 
 	UrlList metainfo.UrlList `bencode:"url-list,omitempty"`
+
+	// rate limits, bytes per second
+	UploadRate   int `json:"upload_rate,omitempty"`
+	DownloadRate int `json:"download_rate,omitempty"`
+
+	// seed goals
+	SeedRatio  float64 `json:"seed_ratio,omitempty"`
+	SeedTime   int64   `json:"seed_time,omitempty"`
+	SeedAction int32   `json:"seed_action,omitempty"`
+
+	QueuePosition int64 `json:"queue_position,omitempty"`
+
+	Sequential bool `json:"sequential,omitempty"`
+	// streaming files, file index -> playback position
+	Streaming map[int]int64 `json:"streaming,omitempty"`
+
+	// on disk files, changed files pieces rechecked on load
+	Files []FileStat `json:"files,omitempty"`
+}
+
+// torrent state collected under lock, files stat'ed and encoded without it
+type torrentSave struct {
+	state *TorrentState
+	files *filePaths
 }
 
-// Save torrent to state file
-func saveTorrentState(t *torrent.Torrent) ([]byte, error) {
-	s := TorrentState{Version: 4}
+func (m *torrentSave) encode() ([]byte, error) {
+	m.state.Files = m.files.stats()
+	return encodeState(m.state)
+}
+
+// Save torrent to state file. lock outside.
+func (s *Session) saveTorrentState(t *torrent.Torrent) *torrentSave {
+	state := TorrentState{Version: stateVersion}
 
 	hash := t.InfoHash()
 
-	fs := filestorage[hash]
+	fs := s.filestorage[hash]
 
 	if t.Info() != nil {
-		s.MetaInfo = &metainfo.MetaInfo{
+		state.MetaInfo = &metainfo.MetaInfo{
 			CreationDate: int64((time.Duration(fs.CreatedOn) * time.Nanosecond).Seconds()),
 			Comment:      fs.Comment,
 			CreatedBy:    fs.Creator,
-			AnnounceList: t.AnnounceList(),
+			AnnounceList: s.trackerTiers(t),
 		}
-		s.MetaInfo.InfoBytes = t.InfoBytes()
+		state.MetaInfo.InfoBytes = t.InfoBytes()
 	} else {
-		s.InfoHash = &hash
-		s.Name = t.Name()
-		s.Trackers = t.AnnounceList()
+		state.InfoHash = &hash
+		state.Name = t.Name()
+		state.Trackers = s.trackerTiers(t)
 	}
 
-	if _, ok := active[t]; ok {
+	if _, ok := s.active[t]; ok {
 		now := time.Now().UnixNano()
-		if pendingCompleted(t) { // seeding
+		if s.pendingCompleted(t) { // seeding
 			fs.SeedingTime = fs.SeedingTime + (now - fs.ActivateDate)
 		} else {
 			fs.DownloadingTime = fs.DownloadingTime + (now - fs.ActivateDate)
@@ -122,70 +224,119 @@ func saveTorrentState(t *torrent.Torrent) ([]byte, error) {
 	}
 
 	stats := t.Stats()
-	s.Downloaded = stats.BytesRead.Int64()
-	s.Uploaded = stats.BytesWritten.Int64()
+	state.Downloaded = stats.BytesRead.Int64()
+	state.Uploaded = stats.BytesWritten.Int64()
 
-	s.DownloadingTime = fs.DownloadingTime
-	s.SeedingTime = fs.SeedingTime
+	state.DownloadingTime = fs.DownloadingTime
+	state.SeedingTime = fs.SeedingTime
 
-	s.AddedDate = fs.AddedDate
-	s.CompletedDate = fs.CompletedDate
+	state.AddedDate = fs.AddedDate
+	state.CompletedDate = fs.CompletedDate
 
-	s.Comment = fs.Comment
-	s.Creator = fs.Creator
-	s.CreatedOn = fs.CreatedOn
+	state.Comment = fs.Comment
+	state.Creator = fs.Creator
+	state.CreatedOn = fs.CreatedOn
 
 	for _, u := range fs.UrlList {
-		s.UrlList = append(s.UrlList, u.Url)
+		state.UrlList = append(state.UrlList, u.Url)
+	}
+
+	state.SeedRatio = fs.SeedRatio
+	state.SeedTime = fs.SeedTime
+	state.SeedAction = fs.SeedAction
+
+	state.QueuePosition = fs.QueuePosition
+
+	state.Sequential = fs.Sequential
+	// maps copied, state encoded after session unlocked
+	for k, v := range fs.Streaming {
+		if state.Streaming == nil {
+			state.Streaming = make(map[int]int64)
+		}
+		state.Streaming[k] = v
 	}
 
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[t.InfoHash()]
 	if t.Info() != nil {
-		torrentstorageLock.Lock()
-		ts := torrentstorage[t.InfoHash()]
-		s.Pieces = ts.Pieces()
-		s.Checks = ts.Checks()
-		s.Root = ts.root
-		torrentstorageLock.Unlock()
+		state.Pieces = ts.Pieces()
+		state.Priorities = ts.Priorities()
+		state.Checks = make([]bool, len(state.Priorities)) // older readers
+		for i, p := range state.Priorities {
+			state.Checks[i] = p != FilePrioritySkip
+		}
+		state.Root = ts.root
+		for k, v := range ts.files {
+			if state.Renames == nil {
+				state.Renames = make(map[int]string)
+			}
+			state.Renames[k] = v
+		}
 	}
+	state.UploadRate = ts.uploadRate
+	state.DownloadRate = ts.downloadRate
+	state.Path = ts.path
+	s.torrentstorageLock.Unlock()
 
-	return json.Marshal(s)
+	return &torrentSave{&state, s.filePaths(t)}
 }
 
-// Load torrent from saved state
-func loadTorrentState(path string, buf []byte) (t *torrent.Torrent, err error) {
-	var s TorrentState
-	err = json.Unmarshal(buf, &s)
+// decode saved state and upgrade it to current version
+func decodeTorrentState(buf []byte) (*TorrentState, error) {
+	var state TorrentState
+	var err error
+	if binaryState(buf) {
+		err = decodeState(buf, &state)
+	} else { // versions 1..5
+		err = json.Unmarshal(buf, &state)
+	}
 	if err != nil {
-		return
+		return nil, err
+	}
+	if state.Version > stateVersion {
+		return nil, ErrStateVersion
 	}
 
-	switch s.Version {
+	switch state.Version {
 	case 1:
-		version1to2(&s)
-		version2to3(&s)
+		version1to2(&state)
+		version2to3(&state)
+		version4to5(&state)
 	case 2:
-		version2to3(&s)
-	case 3: // 3to4 - new field UrlList
+		version2to3(&state)
+		version4to5(&state)
+	case 3, 4: // 3to4 - new field UrlList
+		version4to5(&state)
+	}
+
+	return &state, nil
+}
+
+// register torrent from current version state, used by importers too. 'stats'
+// - current files stats, see stateFilePaths(). lock outside.
+func (s *Session) loadState(path string, state *TorrentState, stats []FileStat) (t *torrent.Torrent, err error) {
+	if path == "" {
+		path = state.Path
 	}
 
 	var spec *torrent.TorrentSpec
 
-	if s.MetaInfo == nil {
+	if state.MetaInfo == nil {
 		spec = &torrent.TorrentSpec{
-			Trackers:    s.Trackers,
-			DisplayName: s.Name,
-			InfoHash:    *s.InfoHash,
+			Trackers:    state.Trackers,
+			DisplayName: state.Name,
+			InfoHash:    *state.InfoHash,
 		}
 	} else {
-		spec = torrent.TorrentSpecFromMetaInfo(s.MetaInfo)
+		spec = torrent.TorrentSpecFromMetaInfo(state.MetaInfo)
 	}
 
-	fs := registerFileStorage(spec.InfoHash, path)
+	fs := s.registerFileStorage(spec.InfoHash, path)
 
 	var n bool
-	t, n = client.AddTorrentInfoHash(spec.InfoHash)
+	t, n = s.client.AddTorrentInfoHash(spec.InfoHash)
 	if !n {
-		err = errors.New("already exists")
+		err = ErrAlreadyExists
 		t = nil
 		return
 	}
@@ -193,48 +344,68 @@ func loadTorrentState(path string, buf []byte) (t *torrent.Torrent, err error) {
 		t.SetDisplayName(spec.DisplayName)
 	}
 
-	torrentstorageLock.Lock()
-	ts := torrentstorage[spec.InfoHash]
-	for i, b := range s.Pieces {
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[spec.InfoHash]
+	for i, b := range state.Pieces {
 		ts.completedPieces.Set(i, b)
 	}
-	ts.checks = s.Checks
-	ts.root = s.Root
-	torrentstorageLock.Unlock()
+	ts.checks = nil
+	ts.priorities = state.Priorities
+	if state.Priorities != nil {
+		ts.checks = make([]bool, len(state.Priorities))
+		for i, p := range state.Priorities {
+			ts.checks[i] = p != FilePrioritySkip
+		}
+	}
+	ts.root = state.Root
+	ts.files = state.Renames
+	ts.uploadRate = state.UploadRate
+	ts.setDownloadRate(state.DownloadRate)
+	s.torrentstorageLock.Unlock()
 
 	if spec.InfoBytes != nil {
 		err = t.LoadInfoBytes(spec.InfoBytes)
 		if err != nil {
 			return
 		}
+		s.fileValidate(t, state.Files, stats)
 		t.UpdateAllPieceCompletions()
 	}
 
 	if t.Info() != nil {
-		fileUpdateCheck(t)
+		s.fileUpdateCheck(t)
 	}
 
 	if spec.ChunkSize != 0 {
 		t.SetChunkSize(pp.Integer(spec.ChunkSize))
 	}
-	t.AddTrackers(spec.Trackers)
+	s.loadTrackers(t, spec.Trackers)
 
-	t.SetStats(s.Downloaded, s.Uploaded)
+	t.SetStats(state.Downloaded, state.Uploaded)
 
-	fs.DownloadingTime = s.DownloadingTime
-	fs.SeedingTime = s.SeedingTime
+	fs.DownloadingTime = state.DownloadingTime
+	fs.SeedingTime = state.SeedingTime
 
-	fs.AddedDate = s.AddedDate
-	fs.CompletedDate = s.CompletedDate
+	fs.AddedDate = state.AddedDate
+	fs.CompletedDate = state.CompletedDate
 
-	fs.Comment = s.Comment
-	fs.Creator = s.Creator
-	fs.CreatedOn = s.CreatedOn
+	fs.Comment = state.Comment
+	fs.Creator = state.Creator
+	fs.CreatedOn = state.CreatedOn
 
-	for _, u := range s.UrlList {
+	for _, u := range state.UrlList {
 		fs.UrlList = append(fs.UrlList, WebSeedUrl{Url: u})
 	}
 
+	fs.SeedRatio = state.SeedRatio
+	fs.SeedTime = state.SeedTime
+	fs.SeedAction = state.SeedAction
+
+	fs.QueuePosition = state.QueuePosition
+
+	fs.Sequential = state.Sequential
+	fs.Streaming = state.Streaming
+
 	return
 }
 
@@ -249,3 +420,17 @@ func version2to3(s *TorrentState) {
 	s.SeedingTime = (time.Duration(s.SeedingTime) * time.Second).Nanoseconds()
 	s.CreatedOn = (time.Duration(s.CreatedOn) * time.Second).Nanoseconds()
 }
+
+func version4to5(s *TorrentState) {
+	if s.Checks == nil || s.Priorities != nil {
+		return
+	}
+	s.Priorities = make([]int32, len(s.Checks))
+	for i, b := range s.Checks {
+		if b {
+			s.Priorities[i] = FilePriorityNormal
+		} else {
+			s.Priorities[i] = FilePrioritySkip
+		}
+	}
+}
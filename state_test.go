@@ -0,0 +1,86 @@
+package libtorrent
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestStateChecksPriorities(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libtorrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := NewConfig()
+	cfg.BindAddr = ":0"
+	s, err := NewSession(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	info, err := bencode.Marshal(metainfo.Info{
+		Name:        "a",
+		PieceLength: 16 * 1024,
+		Pieces:      make([]byte, 20),
+		Files: []metainfo.FileInfo{
+			{Length: 1, Path: []string{"b"}},
+			{Length: 1, Path: []string{"c"}},
+			{Length: 1, Path: []string{"d"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mi bytes.Buffer
+	err = (&metainfo.MetaInfo{InfoBytes: info}).Write(&mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i, err := s.AddTorrentFromBytesE(dir, mi.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp := []int32{FilePriorityHigh, FilePrioritySkip, FilePriorityLow}
+	for p, prio := range pp {
+		err = s.TorrentFilesPriorityE(i, p, prio)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf, err := s.SaveTorrentE(i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state TorrentState
+	err = decodeState(buf, &state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state.Priorities, pp) || !reflect.DeepEqual(state.Checks, []bool{true, false, true}) {
+		t.Fatal(state.Priorities, state.Checks)
+	}
+
+	s.RemoveTorrent(i)
+	i, err = s.LoadTorrentE(dir, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := s.TorrentFilesCount(i); n != len(pp) {
+		t.Fatal(n)
+	}
+	for p, prio := range pp {
+		f := s.TorrentFiles(i, p)
+		if f.Priority != prio || f.Check != (prio != FilePrioritySkip) {
+			t.Error(p, f.Priority, f.Check)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package libtorrent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+)
+
+// Binary state, version 5+:
+//
+//	magic "LTST"
+//	uint32 state version
+//	uint32 json length, json TorrentState (no pieces, no info bytes)
+//	uint32 info length, info bytes
+//	uint32 pieces count, pieces bitfield, high bit first
+//	uint32 crc32 (IEEE) of all above
+//
+// integers are big endian.
+var stateMagic = []byte("LTST")
+
+func binaryState(buf []byte) bool {
+	return bytes.HasPrefix(buf, stateMagic)
+}
+
+func encodeState(state *TorrentState) ([]byte, error) {
+	st := *state // do not touch caller state
+	var info []byte
+	if st.MetaInfo != nil {
+		mi := *st.MetaInfo
+		info = mi.InfoBytes
+		mi.InfoBytes = nil
+		st.MetaInfo = &mi
+	}
+	pieces := st.Pieces
+	st.Pieces = nil
+
+	js, err := json.Marshal(&st)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(stateMagic)
+	binary.Write(&buf, binary.BigEndian, uint32(st.Version))
+	stateWrite(&buf, js)
+	stateWrite(&buf, info)
+	binary.Write(&buf, binary.BigEndian, uint32(len(pieces)))
+	buf.Write(piecesBitfield(pieces))
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()))
+	return buf.Bytes(), nil
+}
+
+func decodeState(buf []byte, state *TorrentState) error {
+	if len(buf) < len(stateMagic)+8 {
+		return ErrBadState
+	}
+	body := buf[:len(buf)-4]
+	if binary.BigEndian.Uint32(buf[len(buf)-4:]) != crc32.ChecksumIEEE(body) {
+		return ErrBadState
+	}
+
+	r := bytes.NewReader(body[len(stateMagic):])
+	var v uint32
+	binary.Read(r, binary.BigEndian, &v)
+	if v > stateVersion { // saved by newer version
+		return ErrStateVersion
+	}
+	js, err := stateRead(r)
+	if err != nil {
+		return err
+	}
+	info, err := stateRead(r)
+	if err != nil {
+		return err
+	}
+	var n uint32
+	err = binary.Read(r, binary.BigEndian, &n)
+	if err != nil {
+		return ErrBadState
+	}
+	bf := make([]byte, (int(n)+7)/8)
+	if r.Len() != len(bf) {
+		return ErrBadState
+	}
+	r.Read(bf)
+
+	err = json.Unmarshal(js, state)
+	if err != nil {
+		return err
+	}
+	if state.MetaInfo != nil {
+		state.MetaInfo.InfoBytes = info
+	}
+	state.Pieces = bitfieldPieces(bf, int(n))
+	return nil
+}
+
+// length prefixed bytes
+func stateWrite(buf *bytes.Buffer, b []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(b)))
+	buf.Write(b)
+}
+
+func stateRead(r *bytes.Reader) ([]byte, error) {
+	var n uint32
+	err := binary.Read(r, binary.BigEndian, &n)
+	if err != nil || int64(n) > int64(r.Len()) {
+		return nil, ErrBadState
+	}
+	b := make([]byte, n)
+	r.Read(b)
+	return b, nil
+}
+
+// high bit first, same as bitfieldPieces() reads
+func piecesBitfield(pieces []bool) []byte {
+	bf := make([]byte, (len(pieces)+7)/8)
+	for i, b := range pieces {
+		if b {
+			bf[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	return bf
+}
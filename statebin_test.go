@@ -0,0 +1,62 @@
+package libtorrent
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestStateBinary(t *testing.T) {
+	state := &TorrentState{
+		Version:    stateVersion,
+		MetaInfo:   &metainfo.MetaInfo{InfoBytes: []byte("d4:name1:ae"), Comment: "c"},
+		Pieces:     []bool{true, false, true, true, false, false, false, false, true},
+		Root:       "b",
+		Priorities: []int32{FilePriorityHigh},
+	}
+	buf, err := encodeState(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !binaryState(buf) || state.MetaInfo.InfoBytes == nil {
+		t.Fatal("encode")
+	}
+
+	var s2 TorrentState
+	err = decodeState(buf, &s2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state, &s2) {
+		t.Error(s2)
+	}
+
+	buf[10] ^= 1
+	if err := decodeState(buf, &s2); err != ErrBadState {
+		t.Error(err)
+	}
+	if err := decodeState(buf[:5], &s2); err != ErrBadState {
+		t.Error(err)
+	}
+}
+
+func TestStateVersion(t *testing.T) {
+	buf, err := encodeState(&TorrentState{Version: stateVersion + 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state TorrentState
+	if err := decodeState(buf, &state); err != ErrStateVersion {
+		t.Error(err)
+	}
+}
+
+func TestStateRootTag(t *testing.T) {
+	var state TorrentState
+	err := json.Unmarshal([]byte(`{"version":4,"Root":"b"}`), &state) // old states saved with broken tag
+	if err != nil || state.Root != "b" {
+		t.Error(state.Root, err)
+	}
+}
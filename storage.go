@@ -4,6 +4,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,24 +12,26 @@ import (
 	"github.com/anacrolix/missinggo/bitmap"
 	"github.com/anacrolix/torrent/metainfo"
 	"github.com/anacrolix/torrent/storage"
+	"golang.org/x/time/rate"
 )
 
-var filestorage map[metainfo.Hash]*fileStorage
-var storageExternal FileStorageTorrent
-var torrentstorage map[metainfo.Hash]*torrentStorage
-var torrentstorageLock sync.Mutex
-
 type FileStorageTorrent interface {
 	ReadFileAt(hash string, path string, buf *Buffer, off int64) (n int, err error) // java unable to change []byte buf if it passed as a parameter
 	WriteFileAt(hash string, path string, b []byte, off int64) (n int, err error)
 	Remove(hash string, path string) error
 	Rename(hash string, old string, path string) error
+	Move(hash string, path string, old string, dir string) error // move 'path' from 'old' to 'dir' download folder
+	Stat(hash string, path string) (*FileStat, error)            // nil - file missing
 }
 
 func TorrentStorageSet(p FileStorageTorrent) {
-	torrentstorageLock.Lock()
-	defer torrentstorageLock.Unlock()
-	storageExternal = p
+	defaultSession.TorrentStorageSet(p)
+}
+
+func (s *Session) TorrentStorageSet(p FileStorageTorrent) {
+	s.torrentstorageLock.Lock()
+	defer s.torrentstorageLock.Unlock()
+	s.storageExternal = p
 }
 
 type Buffer struct {
@@ -67,14 +70,35 @@ type fileStorage struct {
 	Comment   string
 
 	UrlList []WebSeedUrl
+
+	// seed goals, see SeedLimits
+	SeedRatio  float64
+	SeedTime   int64
+	SeedAction int32
+
+	// queue order key, lower starts first. 0 - not set
+	QueuePosition int64
+
+	// download pieces in order
+	Sequential bool
+	// streaming files, file index -> playback position, bytes
+	Streaming map[int]int64
+
+	streamPieces map[int]int              // pieces raised by streamingUpdate(), piece -> level
+	readers      map[*fileReader]int64    // open TorrentFileReader() readers positions
+	scrapes      map[string]*scrapeInfo   // tracker url -> last scrape
+	announces    map[string]*announceInfo // tracker url -> last TorrentReannounce()
+	trackerErrs  map[string]string        // tracker url -> last reported announce error
+	tiers        [][]string               // edited tracker tiers, see trackerTiers()
 }
 
-func registerFileStorage(info metainfo.Hash, path string) *fileStorage {
-	ts := &torrentStorage{path: path}
+func (s *Session) registerFileStorage(info metainfo.Hash, path string) *fileStorage {
+	ts := &torrentStorage{session: s, path: path}
+	ts.setDownloadRate(0)
 
-	torrentstorageLock.Lock()
-	torrentstorage[info] = ts
-	torrentstorageLock.Unlock()
+	s.torrentstorageLock.Lock()
+	s.torrentstorage[info] = ts
+	s.torrentstorageLock.Unlock()
 
 	fs := &fileStorage{
 		AddedDate: time.Now().UnixNano(),
@@ -83,21 +107,32 @@ func registerFileStorage(info metainfo.Hash, path string) *fileStorage {
 		CreatedOn: time.Now().UnixNano(),
 	}
 
-	filestorage[info] = fs
+	s.filestorage[info] = fs
 
 	return fs
 }
 
 type torrentStorage struct {
+	session *Session
+
 	info            *metainfo.Info
 	infoHash        metainfo.Hash
 	path            string
 	checks          []bool
+	priorities      []int32 // FilePriority* per file, nil - all normal. unchecked files keep last level
 	completedPieces bitmap.Bitmap
-	root            string // new torrent name if renamed
+	root            string         // new torrent name if renamed
+	files           map[int]string // renamed files, path relative to torrent root folder, '/' separated
+	moving          *MoveStatus    // TorrentMoveStorage in progress
+	ioLock          sync.RWMutex   // read - storage io on resolved file path, write - file / torrent rename
+	dirty           bool           // state changed since last autosave
 
 	completed bool // fired when torrent downloaded, used for queue engine to roll downloads
 	next      missinggo.Event
+
+	uploadRate      int // bytes per second, 0 - unlimited
+	downloadRate    int
+	downloadLimiter *rate.Limiter
 }
 
 func (m *torrentStorage) Checks() []bool {
@@ -107,6 +142,27 @@ func (m *torrentStorage) Checks() []bool {
 	return checks
 }
 
+// effective file priority
+func (m *torrentStorage) filePriority(i int) int32 {
+	// lock outside
+	if !m.checks[i] {
+		return FilePrioritySkip
+	}
+	if i < len(m.priorities) && m.priorities[i] != FilePrioritySkip {
+		return m.priorities[i]
+	}
+	return FilePriorityNormal
+}
+
+func (m *torrentStorage) Priorities() []int32 {
+	// lock outside
+	pp := make([]int32, len(m.checks))
+	for i := range pp {
+		pp[i] = m.filePriority(i)
+	}
+	return pp
+}
+
 func (m *torrentStorage) Pieces() []bool {
 	// lock outside
 	bf := make([]bool, m.info.NumPieces())
@@ -133,6 +189,7 @@ func (m *torrentStorage) Completed() {
 }
 
 type torrentOpener struct {
+	s *Session
 }
 
 func (m *torrentOpener) Close() error {
@@ -140,10 +197,10 @@ func (m *torrentOpener) Close() error {
 }
 
 func (m *torrentOpener) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
-	torrentstorageLock.Lock()
-	defer torrentstorageLock.Unlock()
+	m.s.torrentstorageLock.Lock()
+	defer m.s.torrentstorageLock.Unlock()
 
-	ts := torrentstorage[infoHash]
+	ts := m.s.torrentstorage[infoHash]
 	ts.info = info
 	ts.infoHash = infoHash
 
@@ -190,42 +247,49 @@ type fileStoragePiece struct {
 	io.ReaderAt
 }
 
+func (m *fileStoragePiece) WriteAt(p []byte, off int64) (int, error) {
+	m.session.torrentstorageLock.Lock()
+	l := m.downloadLimiter
+	m.session.torrentstorageLock.Unlock()
+	limitWait(l, len(p))
+	return m.WriterAt.WriteAt(p, off)
+}
+
 func (m *fileStoragePiece) Completion() storage.Completion {
-	torrentstorageLock.Lock()
-	defer torrentstorageLock.Unlock()
+	m.session.torrentstorageLock.Lock()
+	defer m.session.torrentstorageLock.Unlock()
 	return storage.Completion{Complete: m.completedPieces.Get(m.p.Index()), Ok: true}
 }
 
 func (m *fileStoragePiece) MarkComplete() error {
-	torrentstorageLock.Lock()
-	defer torrentstorageLock.Unlock()
+	m.session.torrentstorageLock.Lock()
+	defer m.session.torrentstorageLock.Unlock()
 	m.completedPieces.Set(m.p.Index(), true)
+	m.dirty = true
 
 	if m.completed {
 		return nil
 	}
 
-	if storageExternal != nil { // create zero flies only once, after torrent downloaded
-		for _, fi := range m.info.UpvertedFiles() {
-			if fi.Length != 0 {
-				continue
-			}
-			var path []string
-			if len(fi.PathUTF8) != 0 {
-				path = fi.PathUTF8
-			} else {
-				path = fi.Path
+	// create zero flies only once, after torrent downloaded
+	for i, fi := range m.info.UpvertedFiles() {
+		if fi.Length != 0 {
+			continue
+		}
+		name := m.fileRel(i, fi)
+		if m.session.storageExternal != nil {
+			_, err := m.session.storageExternal.WriteFileAt(m.infoHash.HexString(), name, []byte{}, 0)
+			if err != nil {
+				return err
 			}
-			name := filepath.Join(append([]string{m.info.Name}, path...)...)
-			_, err := storageExternal.WriteFileAt(m.infoHash.HexString(), name, []byte{}, 0)
+		} else {
+			path := filepath.Join(m.path, name)
+			os.MkdirAll(filepath.Dir(path), 0770)
+			f, err := os.Create(path)
 			if err != nil {
 				return err
 			}
-		}
-	} else {
-		err := storage.CreateNativeZeroLengthFiles(m.info, m.path)
-		if err != nil {
-			return err
+			f.Close()
 		}
 	}
 
@@ -239,9 +303,10 @@ func (m *fileStoragePiece) MarkComplete() error {
 }
 
 func (m *fileStoragePiece) MarkNotComplete() error {
-	torrentstorageLock.Lock()
-	defer torrentstorageLock.Unlock()
+	m.session.torrentstorageLock.Lock()
+	defer m.session.torrentstorageLock.Unlock()
 	m.completedPieces.Set(m.p.Index(), false)
+	m.dirty = true
 	return nil
 }
 
@@ -252,14 +317,16 @@ type fileStorageTorrent struct {
 }
 
 // Returns EOF on short or missing file.
-func (fst *fileStorageTorrent) readFileAt(fi metainfo.FileInfo, b []byte, off int64) (n int, err error) {
-	torrentstorageLock.Lock()
-	rel := fst.fileRel(fi)
+func (fst *fileStorageTorrent) readFileAt(i int, fi metainfo.FileInfo, b []byte, off int64) (n int, err error) {
+	fst.ts.ioLock.RLock()
+	defer fst.ts.ioLock.RUnlock()
+	fst.ts.session.torrentstorageLock.Lock()
+	rel := fst.ts.fileRel(i, fi)
 	path := fst.fileRoot(rel)
-	s := storageExternal
-	torrentstorageLock.Unlock()
+	s := fst.ts.session.storageExternal
+	fst.ts.session.torrentstorageLock.Unlock()
 	if s != nil {
-		return storageExternal.ReadFileAt(fst.hash, rel, &Buffer{b}, off)
+		return s.ReadFileAt(fst.hash, rel, &Buffer{b}, off)
 	}
 	f, err := os.Open(path)
 	if os.IsNotExist(err) {
@@ -288,9 +355,9 @@ func (fst *fileStorageTorrent) readFileAt(fi metainfo.FileInfo, b []byte, off in
 
 // Only returns EOF at the end of the torrent. Premature EOF is ErrUnexpectedEOF.
 func (fst *fileStorageTorrent) ReadAt(b []byte, off int64) (n int, err error) {
-	for _, fi := range fst.info.UpvertedFiles() {
+	for i, fi := range fst.info.UpvertedFiles() {
 		for off < fi.Length {
-			n1, err1 := fst.readFileAt(fi, b, off)
+			n1, err1 := fst.readFileAt(i, fi, b, off)
 			n += n1
 			off += int64(n1)
 			b = b[n1:]
@@ -316,7 +383,7 @@ func (fst *fileStorageTorrent) ReadAt(b []byte, off int64) (n int, err error) {
 }
 
 func (fst *fileStorageTorrent) WriteAt(p []byte, off int64) (n int, err error) {
-	for _, fi := range fst.info.UpvertedFiles() {
+	for i, fi := range fst.info.UpvertedFiles() {
 		if off >= fi.Length {
 			off -= fi.Length
 			continue
@@ -325,28 +392,9 @@ func (fst *fileStorageTorrent) WriteAt(p []byte, off int64) (n int, err error) {
 		if int64(n1) > fi.Length-off {
 			n1 = int(fi.Length - off)
 		}
-		torrentstorageLock.Lock()
-		rel := fst.fileRel(fi)
-		path := fst.fileRoot(rel)
-		s := storageExternal
-		torrentstorageLock.Unlock()
-		if s != nil {
-			n1, err = s.WriteFileAt(fst.hash, rel, p[:n1], off)
-			if err != nil {
-				return
-			}
-		} else {
-			os.MkdirAll(filepath.Dir(path), 0770)
-			var f *os.File
-			f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0660)
-			if err != nil {
-				return
-			}
-			n1, err = f.WriteAt(p[:n1], off)
-			f.Close()
-			if err != nil {
-				return
-			}
+		n1, err = fst.writeFileAt(i, fi, p[:n1], off)
+		if err != nil {
+			return
 		}
 		n += n1
 		off = 0 // next file offset
@@ -358,18 +406,54 @@ func (fst *fileStorageTorrent) WriteAt(p []byte, off int64) (n int, err error) {
 	return
 }
 
-func (fst *fileStorageTorrent) fileRel(fi metainfo.FileInfo) string {
-	name := fst.ts.root
-	if name == "" { // torrent hasen't been renamed
-		name = fst.info.Name // use original name
+func (fst *fileStorageTorrent) writeFileAt(i int, fi metainfo.FileInfo, p []byte, off int64) (n int, err error) {
+	fst.ts.ioLock.RLock()
+	defer fst.ts.ioLock.RUnlock()
+	fst.ts.session.torrentstorageLock.Lock()
+	rel := fst.ts.fileRel(i, fi)
+	path := fst.fileRoot(rel)
+	s := fst.ts.session.storageExternal
+	fst.ts.session.torrentstorageLock.Unlock()
+	if s != nil {
+		return s.WriteFileAt(fst.hash, rel, p, off)
+	}
+	os.MkdirAll(filepath.Dir(path), 0770)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0660)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return f.WriteAt(p, off)
+}
+
+// torrent root folder name (single file name)
+//
+// lock outside
+func (m *torrentStorage) rootName() string {
+	if m.root != "" {
+		return m.root
+	}
+	return m.info.Name // torrent hasen't been renamed, use original name
+}
+
+// file path inside torrent root folder, renamed or original
+//
+// lock outside
+func (m *torrentStorage) filePath(i int, fi metainfo.FileInfo) []string {
+	if p, ok := m.files[i]; ok {
+		return strings.Split(p, "/")
 	}
-	var path []string
 	if len(fi.PathUTF8) != 0 {
-		path = fi.PathUTF8
-	} else {
-		path = fi.Path
+		return fi.PathUTF8
 	}
-	return filepath.Join(append([]string{name}, path...)...)
+	return fi.Path
+}
+
+// file path relative to torrent download folder
+//
+// lock outside
+func (m *torrentStorage) fileRel(i int, fi metainfo.FileInfo) string {
+	return filepath.Join(append([]string{m.rootName()}, m.filePath(i, fi)...)...)
 }
 
 func (fst *fileStorageTorrent) fileRoot(rel string) string {
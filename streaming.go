@@ -0,0 +1,268 @@
+package libtorrent
+
+import (
+	"github.com/anacrolix/missinggo/bitmap"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// default streaming / sequential read-ahead window, bytes
+var StreamingReadahead int64 = 5 * 1024 * 1024
+
+// TorrentSetSequential
+//
+// Download torrent pieces in order. Pieces inside read-ahead window
+// (Config.StreamingReadahead) got raised priority, window moves as pieces
+// arrives.
+//
+//export TorrentSetSequential
+func TorrentSetSequential(i int, b bool) {
+	defaultSession.TorrentSetSequential(i, b)
+}
+
+func (s *Session) TorrentSetSequential(i int, b bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+	fs := s.filestorage[t.InfoHash()]
+	fs.Sequential = b
+	s.streamingUpdate(t)
+	s.stateChanged(t)
+}
+
+//export TorrentSequential
+func TorrentSequential(i int) bool {
+	return defaultSession.TorrentSequential(i)
+}
+
+func (s *Session) TorrentSequential(i int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return false
+	}
+	fs := s.filestorage[t.InfoHash()]
+	return fs.Sequential
+}
+
+// TorrentFileStreaming
+//
+// Streaming mode for file 'p': first and last file pieces downloaded early
+// (media container headers), then pieces in order from playback position, see
+// TorrentFileStreamingPosition().
+//
+//export TorrentFileStreaming
+func TorrentFileStreaming(i int, p int, b bool) {
+	defaultSession.TorrentFileStreaming(i, p, b)
+}
+
+func (s *Session) TorrentFileStreaming(i int, p int, b bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+	fs := s.filestorage[t.InfoHash()]
+	if b {
+		if fs.Streaming == nil {
+			fs.Streaming = make(map[int]int64)
+		}
+		if _, ok := fs.Streaming[p]; !ok {
+			fs.Streaming[p] = 0
+		}
+	} else {
+		delete(fs.Streaming, p)
+	}
+	s.streamingUpdate(t)
+	s.stateChanged(t)
+}
+
+// TorrentFileStreamingPosition
+//
+// Set playback position (bytes from file beginning) for streaming file,
+// read-ahead window follows it.
+//
+//export TorrentFileStreamingPosition
+func TorrentFileStreamingPosition(i int, p int, pos int64) {
+	defaultSession.TorrentFileStreamingPosition(i, p, pos)
+}
+
+func (s *Session) TorrentFileStreamingPosition(i int, p int, pos int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.lookup(i)
+	if err != nil {
+		return
+	}
+	fs := s.filestorage[t.InfoHash()]
+	if _, ok := fs.Streaming[p]; !ok {
+		return
+	}
+	fs.Streaming[p] = pos
+	s.streamingUpdate(t)
+	s.stateChanged(t)
+}
+
+// file offset and length in torrent
+func fileRange(info *metainfo.Info, p int) (int64, int64) {
+	var offset int64
+	for i, fi := range info.UpvertedFiles() {
+		if i == p {
+			return offset, fi.Length
+		}
+		offset += fi.Length
+	}
+	return offset, 0
+}
+
+// read-ahead window inside file
+type streamWindow struct {
+	file    int
+	pos     int64 // bytes from file beginning
+	headers bool  // streaming file, raise first and last file pieces. false - file reader
+}
+
+// pieces to raise for sequential / streaming modes, piece -> level
+func streamingPieces(info *metainfo.Info, checks []bool, completed *bitmap.Bitmap, sequential bool, windows []streamWindow, readahead int64) map[int]int {
+	pp := make(map[int]int)
+
+	raise := func(k int, level int) {
+		if pp[k] < level {
+			pp[k] = level
+		}
+	}
+
+	// window over missing pieces, first gets highest level
+	var n int
+	var bytes int64
+	window := func(k int) bool {
+		if completed.Contains(k) {
+			return true
+		}
+		switch n {
+		case 0:
+			raise(k, pieceNow)
+		case 1:
+			raise(k, pieceNext)
+		default:
+			raise(k, pieceReadahead)
+		}
+		n++
+		bytes += info.PieceLength
+		return bytes < readahead
+	}
+
+	if sequential {
+		filePendingBitmapTs(info, checks).IterTyped(window)
+	}
+
+	for _, w := range windows {
+		if w.file < 0 || w.file >= len(checks) {
+			continue
+		}
+		if w.headers && !checks[w.file] { // unchecked streaming file, readers get any file
+			continue
+		}
+		offset, length := fileRange(info, w.file)
+		if length == 0 {
+			continue
+		}
+		pos := w.pos
+		if pos < 0 || pos >= length {
+			if !w.headers { // reader at EOF
+				continue
+			}
+			pos = 0
+		}
+		b := int(offset / info.PieceLength)
+		e := int((offset + length - 1) / info.PieceLength) // [b, e]
+
+		// container headers
+		if w.headers {
+			for _, k := range []int{b, e} {
+				if !completed.Contains(k) {
+					raise(k, pieceHigh)
+				}
+			}
+		}
+
+		n = 0
+		bytes = 0
+		for k := int((offset + pos) / info.PieceLength); k <= e && window(k); k++ {
+		}
+	}
+
+	return pp
+}
+
+// apply sequential / streaming piece priorities, restore pieces left the
+// read-ahead window.
+func (s *Session) streamingUpdate(t *torrent.Torrent) {
+	fs := s.filestorage[t.InfoHash()]
+
+	s.torrentstorageLock.Lock()
+	ts := s.torrentstorage[t.InfoHash()]
+	info := ts.info
+	if info == nil || ts.checks == nil {
+		s.torrentstorageLock.Unlock()
+		return
+	}
+	checks := ts.Checks()
+	priorities := ts.Priorities()
+	completed := ts.completedPieces.Copy()
+	s.torrentstorageLock.Unlock()
+
+	var windows []streamWindow
+	for p, pos := range fs.Streaming {
+		windows = append(windows, streamWindow{p, pos, true})
+	}
+	for r, pos := range fs.readers {
+		windows = append(windows, streamWindow{r.index, pos, false})
+	}
+
+	pp := streamingPieces(info, checks, &completed, fs.Sequential, windows, s.cfg.StreamingReadahead)
+
+	fb := filePendingBitmapTs(info, checks)
+	fp := filePiecePriorities(info, priorities)
+
+	// level set by fileUpdateCheck()
+	base := func(k int) int {
+		if !fb.Contains(k) {
+			return pieceNone
+		}
+		return filePieceLevel(fp[k])
+	}
+
+	for k := range fs.streamPieces {
+		if _, ok := pp[k]; !ok {
+			setPiecePriority(t, k, base(k))
+		}
+	}
+
+	for k, level := range pp {
+		if b := base(k); b > level {
+			level = b
+			pp[k] = level
+		}
+		if fs.streamPieces[k] != level {
+			setPiecePriority(t, k, level)
+		}
+	}
+
+	fs.streamPieces = pp
+}
+
+// move read-ahead windows for active torrents
+func (s *Session) streamingUpdateAll() {
+	for t := range s.active {
+		fs := s.filestorage[t.InfoHash()]
+		if fs.Sequential || len(fs.Streaming) > 0 || len(fs.readers) > 0 {
+			s.streamingUpdate(t)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package libtorrent
+
+import (
+	"testing"
+
+	"github.com/anacrolix/missinggo/bitmap"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestStreamingPieces(t *testing.T) {
+	info := &metainfo.Info{
+		PieceLength: 10,
+		Files: []metainfo.FileInfo{
+			{Length: 20, Path: []string{"a"}},  // pieces 0, 1
+			{Length: 100, Path: []string{"b"}}, // pieces 2..11
+		},
+	}
+	checks := []bool{true, true}
+
+	var completed bitmap.Bitmap
+	completed.Add(0)
+
+	pp := streamingPieces(info, checks, &completed, true, nil, 30)
+	if len(pp) != 3 || pp[1] != pieceNow || pp[2] != pieceNext || pp[3] != pieceReadahead {
+		t.Error(pp)
+	}
+
+	pp = streamingPieces(info, checks, &completed, false, []streamWindow{{1, 50, true}}, 20)
+	if len(pp) != 4 || pp[2] != pieceHigh || pp[11] != pieceHigh || pp[7] != pieceNow || pp[8] != pieceNext {
+		t.Error(pp)
+	}
+
+	pp = streamingPieces(info, []bool{true, false}, &completed, false, []streamWindow{{1, 0, false}}, 10)
+	if len(pp) != 1 || pp[2] != pieceNow {
+		t.Error(pp)
+	}
+}
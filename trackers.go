@@ -1,9 +1,18 @@
 package libtorrent
 
 import (
+	"fmt"
+	"net/url"
+	"strings"
 	"time"
+
+	"github.com/anacrolix/torrent"
 )
 
+// disabled tracker url prefix inside tiers (uTorrent convention), torrent
+// package fails to parse such urls and never announces them
+const trackerDisabled = "*"
+
 type Tracker struct {
 	// Tracker URI or DHT, LSD, PE
 	Addr         string
@@ -12,62 +21,488 @@ type Tracker struct {
 	NextAnnounce int64
 	Peers        int
 
+	// tier index, -1 for DHT, PEX and LPD
+	Tier    int
+	Enabled bool
+
 	// scrape info
-	LastScrape int64
-	Seeders    int
-	Leechers   int
-	Downloaded int
+	LastScrape  int64
+	ScrapeError string
+	Seeders     int
+	Leechers    int
+	Downloaded  int
 }
 
 func TorrentTrackersCount(i int) int {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.TorrentTrackersCount(i)
+}
 
-	t := torrents[i]
-	fs := filestorage[t.InfoHash()]
-	fs.Trackers = nil
+func (s *Session) TorrentTrackersCount(i int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
+	fs := s.filestorage[t.InfoHash()]
+	tiers := s.trackerTiers(t)
+	urls := make(map[string]bool)
+	for _, tier := range tiers {
+		for _, u := range tier {
+			urls[u] = true
+		}
+	}
+	info := make(map[string]torrent.Tracker)
+	var other []torrent.Tracker // DHT, PEX
 	for _, v := range t.Trackers() {
-		e := ""
-		if v.Err != nil {
-			e = v.Err.Error()
-		}
-		fs.Trackers = append(fs.Trackers, Tracker{v.Url,
-			e,
-			(time.Duration(v.LastAnnounce) * time.Second).Nanoseconds(),
-			(time.Duration(v.NextAnnounce) * time.Second).Nanoseconds(),
-			v.Peers,
-			0, 0, 0, 0})
-	}
-	fs.Trackers = append(fs.Trackers, Tracker{"LPD",
-		"",
-		0,
-		0,
-		lpdCount(t.InfoHash()),
-		0, 0, 0, 0})
+		if urls[v.Url] {
+			info[v.Url] = v
+		} else {
+			other = append(other, v)
+		}
+	}
+	fs.Trackers = nil
+	for k, tier := range tiers {
+		for _, u := range tier {
+			addr := strings.TrimPrefix(u, trackerDisabled)
+			tr := Tracker{Addr: addr, Tier: k, Enabled: addr == u}
+			if v, ok := info[u]; ok && tr.Enabled {
+				tr = trackerInfo(v, k)
+			}
+			if ai, ok := fs.announces[addr]; ok && ai.last > tr.LastAnnounce {
+				tr.Error = ai.err
+				tr.LastAnnounce = ai.last
+				tr.Peers = ai.peers
+			}
+			if si, ok := fs.scrapes[addr]; ok {
+				tr.LastScrape = si.last
+				tr.ScrapeError = si.err
+				tr.Seeders = si.Seeders
+				tr.Leechers = si.Leechers
+				tr.Downloaded = si.Downloaded
+			}
+			fs.Trackers = append(fs.Trackers, tr)
+		}
+	}
+	for _, v := range other {
+		fs.Trackers = append(fs.Trackers, trackerInfo(v, -1))
+	}
+	fs.Trackers = append(fs.Trackers, Tracker{Addr: "LPD", Peers: s.lpdCount(t.InfoHash()), Tier: -1, Enabled: true})
 	return len(fs.Trackers)
 }
 
+func trackerInfo(v torrent.Tracker, tier int) Tracker {
+	e := ""
+	if v.Err != nil {
+		e = v.Err.Error()
+	}
+	return Tracker{
+		Addr:         v.Url,
+		Error:        e,
+		LastAnnounce: (time.Duration(v.LastAnnounce) * time.Second).Nanoseconds(),
+		NextAnnounce: (time.Duration(v.NextAnnounce) * time.Second).Nanoseconds(),
+		Peers:        v.Peers,
+		Tier:         tier,
+		Enabled:      true,
+	}
+}
+
 func TorrentTrackers(i int, p int) *Tracker {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.TorrentTrackers(i, p)
+}
 
-	t := torrents[i]
-	f := filestorage[t.InfoHash()]
+func (s *Session) TorrentTrackers(i int, p int) *Tracker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return nil
+	}
+	f := s.filestorage[t.InfoHash()]
+	if p < 0 || p >= len(f.Trackers) {
+		return nil
+	}
 	return &f.Trackers[p]
 }
 
 func TorrentTrackerRemove(i int, url string) {
-	mu.Lock()
-	defer mu.Unlock()
+	defaultSession.TorrentTrackerRemove(i, url)
+}
 
-	t := torrents[i]
-	t.RemoveTracker(url)
+func (s *Session) TorrentTrackerRemove(i int, url string) {
+	s.setError(s.TorrentTrackerRemoveE(i, url))
+}
+
+func TorrentTrackerRemoveE(i int, url string) error {
+	return defaultSession.TorrentTrackerRemoveE(i, url)
+}
+
+func (s *Session) TorrentTrackerRemoveE(i int, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return err
+	}
+	var tiers [][]string
+	for _, tier := range s.trackerTiers(t) {
+		var n []string
+		for _, u := range tier {
+			if strings.TrimPrefix(u, trackerDisabled) != url {
+				n = append(n, u)
+			}
+		}
+		if len(n) > 0 {
+			tiers = append(tiers, n)
+		}
+	}
+	s.setTrackerTiers(t, tiers)
+	return nil
 }
 
 func TorrentTrackerAdd(i int, addr string) {
-	mu.Lock()
-	defer mu.Unlock()
+	defaultSession.TorrentTrackerAdd(i, addr)
+}
+
+func (s *Session) TorrentTrackerAdd(i int, addr string) {
+	s.setError(s.TorrentTrackerAddE(i, addr))
+}
+
+func TorrentTrackerAddE(i int, addr string) error {
+	return defaultSession.TorrentTrackerAddE(i, addr)
+}
+
+func (s *Session) TorrentTrackerAddE(i int, addr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return err
+	}
+	tiers := s.trackerTiers(t)
+	if !tiersReplace(tiers, addr, addr) {
+		if len(tiers) == 0 {
+			tiers = append(tiers, nil)
+		}
+		tiers[0] = append(tiers[0], addr)
+	}
+	s.setTrackerTiers(t, tiers)
+	return nil
+}
+
+// TorrentTrackerEnable
+//
+// Enable or disable torrent tracker. Disabled tracker keeps its tier and saved
+// with torrent state, but never announced or scraped.
+//
+//export TorrentTrackerEnable
+func TorrentTrackerEnable(i int, url string, enable bool) bool {
+	return defaultSession.TorrentTrackerEnable(i, url, enable)
+}
+
+func (s *Session) TorrentTrackerEnable(i int, url string, enable bool) bool {
+	err := s.TorrentTrackerEnableE(i, url, enable)
+	s.setError(err)
+	return err == nil
+}
+
+func TorrentTrackerEnableE(i int, url string, enable bool) error {
+	return defaultSession.TorrentTrackerEnableE(i, url, enable)
+}
+
+func (s *Session) TorrentTrackerEnableE(i int, url string, enable bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return err
+	}
+	u := url
+	if !enable {
+		u = trackerDisabled + url
+	}
+	tiers := s.trackerTiers(t)
+	if !tiersReplace(tiers, url, u) {
+		return ErrUnknownTracker
+	}
+	s.setTrackerTiers(t, tiers)
+	return nil
+}
+
+// TorrentTrackersTiers
+//
+// Torrent trackers, one url per line, tiers separated by empty line. Disabled
+// trackers prefixed with '*'.
+//
+//export TorrentTrackersTiers
+func TorrentTrackersTiers(i int) string {
+	return defaultSession.TorrentTrackersTiers(i)
+}
+
+func (s *Session) TorrentTrackersTiers(i int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return ""
+	}
+	return formatTiers(s.trackerTiers(t))
+}
+
+// TorrentTrackersSetTiers
+//
+// Replace torrent trackers, same format as TorrentTrackersTiers() returns
+// (Transmission 'trackerList'). Trackers missing from the list removed.
+//
+//export TorrentTrackersSetTiers
+func TorrentTrackersSetTiers(i int, tiers string) bool {
+	return defaultSession.TorrentTrackersSetTiers(i, tiers)
+}
 
-	t := torrents[i]
-	t.AddTrackers([][]string{[]string{addr}})
+func (s *Session) TorrentTrackersSetTiers(i int, tiers string) bool {
+	err := s.TorrentTrackersSetTiersE(i, tiers)
+	s.setError(err)
+	return err == nil
+}
+
+func TorrentTrackersSetTiersE(i int, tiers string) error {
+	return defaultSession.TorrentTrackersSetTiersE(i, tiers)
+}
+
+func (s *Session) TorrentTrackersSetTiersE(i int, tiers string) error {
+	tt, err := parseTiers(tiers)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return err
+	}
+	s.setTrackerTiers(t, tt)
+	return nil
+}
+
+// scrape active torrents and report new announce errors every second
+func (s *Session) trackersEngine() {
+	s.mu.Lock()
+	if s.client == nil {
+		s.mu.Unlock()
+		return
+	}
+	clientClose := s.client.Wait()
+	s.mu.Unlock()
+
+	for {
+		select {
+		case <-clientClose:
+			return
+		case <-time.After(1 * time.Second):
+		}
+		s.mu.Lock()
+		if s.client == nil { // closed
+			s.mu.Unlock()
+			return
+		}
+		s.scrapeUpdate()
+		s.trackersUpdate()
+		s.mu.Unlock()
+	}
+}
+
+// report torrent package announce errors, once per new error. lock outside.
+func (s *Session) trackersUpdate() {
+	for t := range s.active {
+		fs := s.filestorage[t.InfoHash()]
+		for _, v := range t.Trackers() {
+			if v.Url == "DHT" || v.Url == "PEX" {
+				continue
+			}
+			e := ""
+			if v.Err != nil {
+				e = v.Err.Error()
+			}
+			if fs.trackerErrs[v.Url] == e {
+				continue
+			}
+			if fs.trackerErrs == nil {
+				fs.trackerErrs = make(map[string]string)
+			}
+			fs.trackerErrs[v.Url] = e
+			if e != "" {
+				s.eventError(t, fmt.Errorf("%s: %s", v.Url, e))
+			}
+		}
+	}
+}
+
+// torrent tracker tiers, disabled trackers '*' prefixed. torrent package only
+// knows enabled trackers, so edited tiers kept in fileStorage and trackers
+// added later (magnet merge, state load) appended to them. lock outside.
+func (s *Session) trackerTiers(t *torrent.Torrent) [][]string {
+	fs := s.filestorage[t.InfoHash()]
+	var tiers [][]string
+	known := make(map[string]bool)
+	for _, tier := range fs.tiers {
+		tiers = append(tiers, append([]string(nil), tier...))
+		for _, u := range tier {
+			known[strings.TrimPrefix(u, trackerDisabled)] = true
+		}
+	}
+	for k, tier := range t.AnnounceList() {
+		for _, u := range tier {
+			addr := strings.TrimPrefix(u, trackerDisabled)
+			if known[addr] {
+				continue
+			}
+			known[addr] = true
+			for len(tiers) <= k {
+				tiers = append(tiers, nil)
+			}
+			tiers[k] = append(tiers[k], u)
+		}
+	}
+	var n [][]string
+	for _, tier := range tiers {
+		if len(tier) > 0 {
+			n = append(n, tier)
+		}
+	}
+	return n
+}
+
+// pass enabled trackers to torrent, drop removed ones. torrent package keeps
+// stopped announcer for removed url, so removed or disabled and enabled back
+// tracker announced again after torrent restart (or TorrentReannounce()).
+// lock outside.
+func (s *Session) setTrackerTiers(t *torrent.Torrent, tiers [][]string) {
+	fs := s.filestorage[t.InfoHash()]
+	enabled := trackersEnabled(tiers)
+	keep := make(map[string]bool)
+	for _, tier := range enabled {
+		for _, u := range tier {
+			keep[u] = true
+		}
+	}
+	var remove []string
+	for _, tier := range t.AnnounceList() {
+		for _, u := range tier {
+			if !keep[u] {
+				remove = append(remove, u)
+			}
+		}
+	}
+	for _, u := range remove {
+		t.RemoveTracker(u)
+	}
+	t.AddTrackers(enabled)
+	for u := range fs.scrapes {
+		if !keep[u] {
+			delete(fs.scrapes, u)
+		}
+	}
+	for u := range fs.announces {
+		if !keep[u] {
+			delete(fs.announces, u)
+		}
+	}
+	for u := range fs.trackerErrs {
+		if !keep[u] {
+			delete(fs.trackerErrs, u)
+		}
+	}
+	fs.tiers = tiers
+	s.stateChanged(t)
+}
+
+// add trackers from torrent state, keep disabled ones. lock outside.
+func (s *Session) loadTrackers(t *torrent.Torrent, tiers [][]string) {
+	enabled := trackersEnabled(tiers)
+	t.AddTrackers(enabled)
+	for _, tier := range tiers {
+		for _, u := range tier {
+			if strings.HasPrefix(u, trackerDisabled) {
+				s.filestorage[t.InfoHash()].tiers = tiers
+				return
+			}
+		}
+	}
+}
+
+// tiers without disabled trackers and empty tiers
+func trackersEnabled(tiers [][]string) [][]string {
+	var enabled [][]string
+	for _, tier := range tiers {
+		var n []string
+		for _, u := range tier {
+			if !strings.HasPrefix(u, trackerDisabled) {
+				n = append(n, u)
+			}
+		}
+		if len(n) > 0 {
+			enabled = append(enabled, n)
+		}
+	}
+	return enabled
+}
+
+// replace tracker 'url' (enabled or disabled) with 'u', false if not found
+func tiersReplace(tiers [][]string, url string, u string) bool {
+	for _, tier := range tiers {
+		for k, v := range tier {
+			if strings.TrimPrefix(v, trackerDisabled) == url {
+				tier[k] = u
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// url per line, empty line between tiers. duplicates dropped.
+func parseTiers(str string) ([][]string, error) {
+	var tiers [][]string
+	var tier []string
+	known := make(map[string]bool)
+	for _, l := range strings.Split(str, "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			if len(tier) > 0 {
+				tiers = append(tiers, tier)
+				tier = nil
+			}
+			continue
+		}
+		u := strings.TrimPrefix(l, trackerDisabled)
+		p, err := url.Parse(u)
+		if err != nil || p.Scheme == "" || p.Host == "" {
+			return nil, ErrBadTracker
+		}
+		if known[u] {
+			continue
+		}
+		known[u] = true
+		tier = append(tier, l)
+	}
+	if len(tier) > 0 {
+		tiers = append(tiers, tier)
+	}
+	return tiers, nil
+}
+
+func formatTiers(tiers [][]string) string {
+	var ss []string
+	for _, tier := range tiers {
+		ss = append(ss, strings.Join(tier, "\n"))
+	}
+	return strings.Join(ss, "\n\n")
 }
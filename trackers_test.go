@@ -0,0 +1,36 @@
+package libtorrent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTiers(t *testing.T) {
+	tiers, err := parseTiers("http://a/announce\n*udp://b:80\nhttp://a/announce\n\n\n http://c/announce \n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"http://a/announce", "*udp://b:80"}, {"http://c/announce"}}
+	if !reflect.DeepEqual(tiers, want) {
+		t.Fatal(tiers)
+	}
+	if s := formatTiers(tiers); s != "http://a/announce\n*udp://b:80\n\nhttp://c/announce" {
+		t.Error(s)
+	}
+	if e := trackersEnabled(tiers); !reflect.DeepEqual(e, [][]string{{"http://a/announce"}, {"http://c/announce"}}) {
+		t.Error(e)
+	}
+	if _, err := parseTiers("announce"); err != ErrBadTracker {
+		t.Error(err)
+	}
+}
+
+func TestTrackerUnknownTorrent(t *testing.T) {
+	s := newSession(NewConfig())
+	if err := s.TorrentTrackerAddE(7, "http://a/announce"); err != ErrUnknownTorrent {
+		t.Error(err)
+	}
+	if err := s.TorrentTrackerRemoveE(7, "http://a/announce"); err != ErrUnknownTorrent {
+		t.Error(err)
+	}
+}
@@ -16,7 +16,6 @@ import (
 
 	"github.com/anacrolix/missinggo/bitmap"
 	"github.com/anacrolix/torrent"
-	"github.com/anacrolix/torrent/metainfo"
 )
 
 // http://bittorrent.org/beps/bep_0017.html - httpseeds
@@ -28,8 +27,6 @@ const WEBSEED_SPLIT = 10 * 1024 * 1024                 // how large split for si
 const WEBSEED_BUF = 64 * 1024                          // read buffer size
 const WEBSEED_TIMEOUT = time.Duration(5 * time.Second) // dial up and socket read timeouts
 
-var webseedstorage map[metainfo.Hash]*webSeeds
-
 type WebSeedUrl struct {
 	Url        string
 	Downloaded int64  // total bytes / speed test
@@ -37,66 +34,84 @@ type WebSeedUrl struct {
 }
 
 func TorrentWebSeedsCount(i int) int {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.TorrentWebSeedsCount(i)
+}
+
+func (s *Session) TorrentWebSeedsCount(i int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	t := torrents[i]
+	t, err := s.lookup(i)
+	if err != nil {
+		return 0
+	}
 	hash := t.InfoHash()
-	fs := filestorage[hash]
+	fs := s.filestorage[hash]
 
 	return len(fs.UrlList)
 }
 
 func TorrentWebSeeds(i int, p int) *WebSeedUrl {
-	mu.Lock()
-	defer mu.Unlock()
+	return defaultSession.TorrentWebSeeds(i, p)
+}
 
-	t := torrents[i]
+func (s *Session) TorrentWebSeeds(i int, p int) *WebSeedUrl {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.lookup(i)
+	if err != nil {
+		return nil
+	}
 	hash := t.InfoHash()
-	fs := filestorage[hash]
+	fs := s.filestorage[hash]
 
 	return &fs.UrlList[p]
 }
 
 func WebSeedStart(t *torrent.Torrent) {
-	mu.Lock()
-	defer mu.Unlock()
+	defaultSession.WebSeedStart(t)
+}
+
+func (s *Session) WebSeedStart(t *torrent.Torrent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if _, ok := active[t]; !ok {
+	if _, ok := s.active[t]; !ok {
 		return // called on paused torrent
 	}
 
-	webSeedStart(t)
+	s.webSeedStart(t)
 }
 
 // sine we can dynamically add / done webSeeds, we have add one per call
-func webSeedStart(t *torrent.Torrent) {
+func (s *Session) webSeedStart(t *torrent.Torrent) {
 	hash := t.InfoHash()
 
 	var ws *webSeeds
-	if w, ok := webseedstorage[hash]; ok { // currenlty active webseeds for torrent
+	if w, ok := s.webseedstorage[hash]; ok { // currenlty active webseeds for torrent
 		ws = w
 	} else {
-		ws = &webSeeds{}
+		ws = &webSeeds{s: s}
 		info := t.Info()
 		ws.t = t
 		ws.chunks = make([][]int64, info.NumPieces())
 		ws.ww = make(map[*webSeed]bool)
-		webseedstorage[hash] = ws
+		s.webseedstorage[hash] = ws
 	}
 
-	if len(ws.ww) >= WEBSEED_CONCURENT { // limit? exit
+	if len(ws.ww) >= s.cfg.WebSeedConcurent { // limit? exit
 		return
 	}
 
-	fs := filestorage[hash]
+	fs := s.filestorage[hash]
 
 	if len(fs.UrlList) == 0 { // no webseed urls? exit
 		return
 	}
 
-	torrentstorageLock.Lock() // ts block
-	ts := torrentstorage[hash]
+	s.torrentstorageLock.Lock() // ts block
+	ts := s.torrentstorage[hash]
 
 	info := ts.info
 
@@ -106,18 +121,18 @@ func webSeedStart(t *torrent.Torrent) {
 		{ // add user selected files
 			var offset int64
 			for i, fi := range info.UpvertedFiles() {
-				s := offset / info.PieceLength
+				b := offset / info.PieceLength
 				e := (offset + fi.Length) / info.PieceLength
 				r := (offset + fi.Length) % info.PieceLength
 				if r > 0 {
 					e++
 				}
 				if ts.checks[i] {
-					selected.AddRange(int(s), int(e))
+					selected.AddRange(int(b), int(e))
 					bm := &bitmap.Bitmap{}
-					bm.AddRange(int(s), int(e))
-					path := strings.Join(append([]string{ts.info.Name}, fi.Path...), "/") // keep original torrent name unrenamed
-					f := &webFile{path, offset, fi.Length, int(s), int(e), bm, 0}         // [s, e)
+					bm.AddRange(int(b), int(e))
+					path := strings.Join(append([]string{ts.info.Name}, fi.Path...), "/") // keep original torrent and file names unrenamed, remote server has original layout
+					f := &webFile{path, offset, fi.Length, int(b), int(e), bm, 0}         // [b, e)
 					ws.ff[f] = true
 				}
 				offset += fi.Length
@@ -126,14 +141,14 @@ func webSeedStart(t *torrent.Torrent) {
 		{ // add rest pices files
 			var offset int64
 			for _, fi := range info.UpvertedFiles() {
-				s := offset / info.PieceLength
+				b := offset / info.PieceLength
 				e := (offset + fi.Length) / info.PieceLength
 				r := (offset + fi.Length) % info.PieceLength
 				if r > 0 {
 					e++
 				}
 
-				path := strings.Join(append([]string{ts.info.Name}, fi.Path...), "/") // keep original torrent name unrenamed
+				path := strings.Join(append([]string{ts.info.Name}, fi.Path...), "/") // keep original torrent and file names unrenamed, remote server has original layout
 
 				found := false
 				for f := range ws.ff {
@@ -145,10 +160,10 @@ func webSeedStart(t *torrent.Torrent) {
 
 				if !found { // if file is not selected
 					bm := &bitmap.Bitmap{}
-					bm.AddRange(int(s), int(e))
+					bm.AddRange(int(b), int(e))
 					if bitmapIntersectsBm(selected, bm) { // and it belong to picece selected
 						and := bitmapAnd(bm, selected)
-						f := &webFile{path, offset, fi.Length, int(s), int(e), and, 0}
+						f := &webFile{path, offset, fi.Length, int(b), int(e), and, 0}
 						ws.ff[f] = true
 					}
 				}
@@ -183,7 +198,7 @@ func webSeedStart(t *torrent.Torrent) {
 		}
 	}
 
-	torrentstorageLock.Unlock() // ts block
+	s.torrentstorageLock.Unlock() // ts block
 
 	if len(ws.ff) == 0 {
 		return
@@ -217,7 +232,7 @@ func webSeedStart(t *torrent.Torrent) {
 					w := &webSeed{ws, t, u, f, f.start, f.end, nil}
 					ws.ww[w] = true
 					w.Start()
-					webSeedStart(t)
+					s.webSeedStart(t)
 					return
 				}
 			}
@@ -229,7 +244,7 @@ func webSeedStart(t *torrent.Torrent) {
 		for u := range ws.uu { // choise right url, skip url if it is limited
 			if ws.UrlReady(u) && u.r {
 				fileParts := w1.file.bm.Len() // how many undownloaded pieces in a file
-				splitCount := WEBSEED_CONCURENT
+				splitCount := s.cfg.WebSeedConcurent
 				piecesGrab := fileParts / splitCount // how many pieces to grab per webSeed
 				for int64(piecesGrab)*info.PieceLength < WEBSEED_SPLIT && splitCount > 1 {
 					splitCount-- // webSeed smaller then WEBSEED_SPLIT, increase side by reducing splits
@@ -243,7 +258,7 @@ func webSeedStart(t *torrent.Torrent) {
 						w2 := &webSeed{ws, t, u, w1.file, w1.end, end, nil}
 						ws.ww[w2] = true
 						w2.Start()
-						webSeedStart(t)
+						s.webSeedStart(t)
 						return
 					}
 				}
@@ -259,7 +274,7 @@ func webSeedStart(t *torrent.Torrent) {
 			u.e = false
 			ws.Extract(u)
 			if u.e {
-				webSeedStart(t)
+				s.webSeedStart(t)
 			}
 			if len(ws.ww) == 0 { // check if all urls are broken and not downloading
 				all := true
@@ -271,7 +286,7 @@ func webSeedStart(t *torrent.Torrent) {
 				if all {
 					go func() {
 						time.Sleep(WEBSEED_TIMEOUT)
-						WebSeedStart(t) // then start delayed checks
+						s.WebSeedStart(t) // then start delayed checks
 					}()
 				}
 			}
@@ -280,13 +295,13 @@ func webSeedStart(t *torrent.Torrent) {
 	}
 }
 
-func webSeedStop(t *torrent.Torrent) {
+func (s *Session) webSeedStop(t *torrent.Torrent) {
 	hash := t.InfoHash()
-	if ws, ok := webseedstorage[hash]; ok {
+	if ws, ok := s.webseedstorage[hash]; ok {
 		for v := range ws.ww {
 			v.Close()
 		}
-		delete(webseedstorage, hash)
+		delete(s.webseedstorage, hash)
 	}
 }
 
@@ -421,14 +436,14 @@ func (m *webSeed) Run(req *http.Request) {
 	var del error
 
 	defer func() {
-		mu.Lock()
+		m.ws.s.mu.Lock()
 		m.autoClose()
 		if del != nil {
 			m.ws.UrlDelete(m.url, del)
 		}
-		mu.Unlock()
+		m.ws.s.mu.Unlock()
 		if next {
-			WebSeedStart(m.t)
+			m.ws.s.WebSeedStart(m.t)
 		}
 	}()
 
@@ -497,9 +512,9 @@ func (m *webSeed) Run(req *http.Request) {
 
 	resp, conn, err := dialTimeout(req)
 
-	mu.Lock()
+	m.ws.s.mu.Lock()
 	cancel := m.cancel
-	mu.Unlock()
+	m.ws.s.mu.Unlock()
 	if cancel == nil { // canceled
 		return // return, no next
 	}
@@ -539,10 +554,10 @@ func (m *webSeed) Run(req *http.Request) {
 		conn.SetDeadline(time.Now().Add(WEBSEED_TIMEOUT))
 		n, err := r.Read(buf)
 
-		mu.Lock()
+		m.ws.s.mu.Lock()
 		k := int64(m.end) * info.PieceLength // update end
 		cancel := m.cancel
-		mu.Unlock()
+		m.ws.s.mu.Unlock()
 		if k < end {
 			end = k // new end less then old one
 		}
@@ -551,11 +566,11 @@ func (m *webSeed) Run(req *http.Request) {
 		}
 
 		if n == 0 { // done
-			mu.Lock()
+			m.ws.s.mu.Lock()
 			for _, p := range parts {
 				m.file.downloaded += p[2]
 			}
-			mu.Unlock()
+			m.ws.s.mu.Unlock()
 			next = true
 			if err != io.EOF {
 				log.Println("download error", formatWebSeed(m), err)
@@ -563,9 +578,9 @@ func (m *webSeed) Run(req *http.Request) {
 			return // start next webSeed
 		}
 
-		mu.Lock()
+		m.ws.s.mu.Lock()
 		m.url.wsu.Downloaded += int64(n) // speedtest
-		mu.Unlock()
+		m.ws.s.mu.Unlock()
 
 		rest := buf[:n]
 		for n > 0 {
@@ -587,7 +602,7 @@ func (m *webSeed) Run(req *http.Request) {
 
 			pend := fstart + rmin + p[2]
 			if pend > end { // reached end of webSeed.end (overriden by new webSeed)
-				mu.Lock()
+				m.ws.s.mu.Lock()
 				size := int64(0)
 				for _, p := range parts {
 					pend := p[0] + p[2]
@@ -601,7 +616,7 @@ func (m *webSeed) Run(req *http.Request) {
 					size += p[2]
 				}
 				m.file.downloaded += size
-				mu.Unlock()
+				m.ws.s.mu.Unlock()
 				next = true
 				return // start next webSeed
 			}
@@ -625,6 +640,7 @@ func (m *webSeed) Close() {
 }
 
 type webSeeds struct {
+	s      *Session
 	t      *torrent.Torrent
 	chunks [][]int64         // pieces / chunk size map
 	uu     map[*webUrl]bool  // source url extraceted and cleared if url broken / slow / has missing files
@@ -645,7 +661,7 @@ func (m *webSeeds) UrlUseCount(u *webUrl) int {
 func (m *webSeeds) UrlReady(u *webUrl) bool {
 	if u.e && u.n == 0 {
 		count := m.UrlUseCount(u) // how many concurent downloads per url
-		if count < WEBSEED_URL_CONCURENT {
+		if count < m.s.cfg.WebSeedUrlConcurent {
 			return true
 		}
 	}
@@ -655,6 +671,7 @@ func (m *webSeeds) UrlReady(u *webUrl) bool {
 func (m *webSeeds) UrlDelete(u *webUrl, err error) {
 	u.wsu.Error = err.Error()
 	u.n = time.Now().Add(WEBSEED_TIMEOUT).UnixNano()
+	m.s.eventError(m.t, fmt.Errorf("%s: %s", u.url, err))
 }
 
 func (m *webSeeds) Extract(u *webUrl) error {
@@ -667,8 +684,8 @@ func (m *webSeeds) Extract(u *webUrl) error {
 	}
 	var err error
 	func() { // auto lock after panic()
-		mu.Unlock()
-		defer mu.Lock()
+		m.s.mu.Unlock()
+		defer m.s.mu.Lock()
 		err = u.Extract(path)
 	}()
 	if err != nil {
@@ -692,6 +709,7 @@ type MultipartReader struct {
 
 func (m *MultipartReader) Read(b []byte) (int, error) {
 	if m.p == nil {
+		var err error
 		m.p, err = m.mr.NextPart()
 		if err != nil {
 			return 0, err